@@ -6,14 +6,18 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // часовые пояса отчетов доступны и в образе без tzdata
 
 	_ "github.com/lib/pq"
 
 	"user-segmentation-service/config"
 	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/report"
 	"user-segmentation-service/internal/server"
+	"user-segmentation-service/internal/worker"
 )
 
 func main() {
@@ -32,10 +36,54 @@ func main() {
 		log.Fatal(err) // Завершение программы, если не удается подключиться к БД
 	}
 
-	myDB := db.NewDB(sqlDB)
+	// Часовой пояс периодов отчетов
+	reportLocation, err := time.LoadLocation(cfg.Report.TimeZone)
+	if err != nil {
+		log.Fatal(err) // Завершение программы, если часовой пояс указан неверно
+	}
+
+	// Хранилище файлов отчетов
+	storage, err := report.NewStorage(cfg.Report)
+	if err != nil {
+		log.Fatal(err) // Завершение программы, если хранилище отчетов настроено неверно
+	}
 
-	// Запуск приложения
-	srv := server.NewApp(myDB).Run(cfg)
+	myDB := db.NewDB(sqlDB, cfg.Hasher.Salt, cfg.PG.QueryTimeout, storage)
+
+	// Запуск фоновых задач, которые останавливаются вместе с сервером
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	reaper := worker.NewReaper(myDB, cfg.Expiration.Interval, cfg.Expiration.BatchSize)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reaper.Run(workersCtx)
+	}()
+
+	scheduler := worker.NewRolloutScheduler(myDB, cfg.Rollout.Interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(workersCtx)
+	}()
+
+	reports := worker.NewReportWorkers(myDB, cfg.Report.Workers, cfg.Report.Interval, cfg.Report.Lease)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reports.Run(workersCtx)
+	}()
+
+	// Запуск приложения. Контекст запросов отменяется, если они не успели завершиться при остановке сервера
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	// Отчеты из локального каталога раздает сам сервис, из внешнего хранилища – хранилище по подписанным ссылкам
+	var reportDir string
+	if cfg.Report.Storage == report.StorageLocal {
+		reportDir = cfg.Report.Dir
+	}
+	srv := server.NewApp(myDB, cfg.HTTP.BatchGetLimit, reportLocation, reportDir).Run(requestsCtx, cfg)
 
 	quit := make(chan os.Signal, 1)
 
@@ -43,12 +91,17 @@ func main() {
 	<-quit
 	log.Println("Shutdown Server ...")
 
+	stopWorkers()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
+		cancelRequests()
 		log.Fatal("Server Shutdown:", err)
 	}
 
+	wg.Wait()
+
 	<-ctx.Done()
 	log.Println("timeout of 5 seconds.")
 	log.Println("Server exiting")
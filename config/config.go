@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 )
@@ -13,10 +15,16 @@ type (
 		Log
 		PG
 		Hasher
+		Expiration
+		Rollout
+		Report
 	}
 
 	HTTP struct {
 		Port string `yaml:"port" env:"HTTP_PORT"`
+
+		// BatchGetLimit ограничивает количество пользователей в одном запросе сегментов нескольких пользователей
+		BatchGetLimit int `yaml:"batch_get_limit" env:"HTTP_BATCH_GET_LIMIT" env-default:"500"`
 	}
 
 	Log struct {
@@ -31,11 +39,61 @@ type (
 		User     string `env:"POSTGRES_USER"`
 		Password string `env:"POSTGRES_PASSWORD"`
 		DBName   string `env:"POSTGRES_DB"`
+
+		// QueryTimeout ограничивает время одной операции с базой данных; 0 – без ограничения
+		QueryTimeout time.Duration `env:"PG_QUERY_TIMEOUT" env-default:"30s"`
 	}
 
 	Hasher struct {
 		Salt string `env:"HASHER_SALT"`
 	}
+
+	// Expiration настройки фоновой очистки просроченных сегментов пользователей
+	Expiration struct {
+		Interval  time.Duration `yaml:"interval" env:"EXPIRATION_INTERVAL" env-default:"1m"`
+		BatchSize int           `yaml:"batch_size" env:"EXPIRATION_BATCH_SIZE" env-default:"1000"`
+	}
+
+	// Rollout настройки планировщика постепенной раскатки сегментов
+	Rollout struct {
+		Interval time.Duration `yaml:"interval" env:"ROLLOUT_INTERVAL" env-default:"1m"`
+	}
+
+	// Report настройки отчетов по истории сегментов
+	Report struct {
+		// TimeZone часовой пояс IANA, в котором задаются даты периода отчета и считаются дни
+		TimeZone string `yaml:"time_zone" env:"REPORT_TIME_ZONE" env-default:"UTC"`
+
+		// Workers количество отчетов, создаваемых в фоне одновременно; Interval – период проверки очереди заданий
+		Workers  int           `yaml:"workers" env:"REPORT_WORKERS" env-default:"2"`
+		Interval time.Duration `yaml:"interval" env:"REPORT_INTERVAL" env-default:"5s"`
+
+		// Lease срок аренды выполняемого задания. Обработчик продлевает аренду каждую треть срока; задание,
+		// аренда которого истекла (экземпляр сервиса остановлен или потерял связь с БД), возвращается в очередь
+		Lease time.Duration `yaml:"lease" env:"REPORT_LEASE" env-default:"1m"`
+
+		// Storage хранилище файлов отчетов: local – каталог Dir, файлы которого раздает сервис по ссылкам Host + имя файла;
+		// s3 – бакет S3-совместимого хранилища (см. S3)
+		Storage string `yaml:"storage" env:"REPORT_STORAGE" env-default:"local"`
+		Dir     string `yaml:"dir" env:"REPORT_DIR" env-default:"reports"`
+		Host    string `env:"HTTP_REPORT_HOST"`
+		S3      S3     `yaml:"s3"`
+	}
+
+	// S3 настройки S3-совместимого хранилища отчетов (AWS S3, MinIO и др.)
+	S3 struct {
+		Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT"`
+		Region          string `yaml:"region" env:"S3_REGION" env-default:"us-east-1"`
+		Bucket          string `yaml:"bucket" env:"S3_BUCKET"`
+		AccessKeyID     string `env:"S3_ACCESS_KEY_ID"`
+		SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY"`
+
+		// PathStyle адресует бакет в пути (endpoint/bucket/key), а не в имени хоста; нужен для MinIO
+		PathStyle bool `yaml:"path_style" env:"S3_PATH_STYLE" env-default:"true"`
+
+		// LinkExpiry срок действия ссылок на скачивание отчетов, не более 7 дней
+		LinkExpiry time.Duration `yaml:"link_expiry" env:"S3_LINK_EXPIRY" env-default:"24h"`
+	}
 )
 
 func NewConfig(configPath string) (*Config, error) {
@@ -55,5 +113,41 @@ func NewConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error updating env: %w", err)
 	}
 
+	err = cfg.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return cfg, nil
 }
+
+// minReportLease минимальный срок аренды задания на создание отчета: аренда продлевается каждую треть срока,
+// и за это время должен успеть выполниться запрос к базе данных
+const minReportLease = 3 * time.Second
+
+// validate проверяет настройки фоновых обработчиков: при нулевом или отрицательном интервале time.NewTicker
+// вызывает панику, а при неположительном размере пачки очистка просроченных сегментов не завершается
+func (cfg *Config) validate() error {
+	intervals := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"EXPIRATION_INTERVAL", cfg.Expiration.Interval},
+		{"ROLLOUT_INTERVAL", cfg.Rollout.Interval},
+		{"REPORT_INTERVAL", cfg.Report.Interval},
+	}
+	for _, i := range intervals {
+		if i.interval <= 0 {
+			return fmt.Errorf("%s should be positive, got %s", i.name, i.interval)
+		}
+	}
+
+	if cfg.Expiration.BatchSize <= 0 {
+		return fmt.Errorf("EXPIRATION_BATCH_SIZE should be positive, got %d", cfg.Expiration.BatchSize)
+	}
+	if cfg.Report.Lease < minReportLease {
+		return fmt.Errorf("REPORT_LEASE should be at least %s, got %s", minReportLease, cfg.Report.Lease)
+	}
+
+	return nil
+}
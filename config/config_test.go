@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(cfg *Config)
+		expectedError string
+	}{
+		{
+			name:   "Valid Config",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:          "Zero Expiration Interval",
+			modify:        func(cfg *Config) { cfg.Expiration.Interval = 0 },
+			expectedError: "EXPIRATION_INTERVAL should be positive, got 0s",
+		},
+		{
+			name:          "Negative Rollout Interval",
+			modify:        func(cfg *Config) { cfg.Rollout.Interval = -time.Minute },
+			expectedError: "ROLLOUT_INTERVAL should be positive, got -1m0s",
+		},
+		{
+			name:          "Zero Report Interval",
+			modify:        func(cfg *Config) { cfg.Report.Interval = 0 },
+			expectedError: "REPORT_INTERVAL should be positive, got 0s",
+		},
+		{
+			name:          "Zero Expiration Batch Size",
+			modify:        func(cfg *Config) { cfg.Expiration.BatchSize = 0 },
+			expectedError: "EXPIRATION_BATCH_SIZE should be positive, got 0",
+		},
+		{
+			name:          "Report Lease Too Short",
+			modify:        func(cfg *Config) { cfg.Report.Lease = 2 * time.Second },
+			expectedError: "REPORT_LEASE should be at least 3s, got 2s",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{
+				Expiration: Expiration{Interval: time.Minute, BatchSize: 1000},
+				Rollout:    Rollout{Interval: time.Minute},
+				Report:     Report{Interval: 5 * time.Second, Lease: time.Minute},
+			}
+			tc.modify(cfg)
+
+			err := cfg.validate()
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package bucket реализует детерминированное распределение пользователей по процентным корзинам.
+//
+// Корзина вычисляется как первые 4 байта md5(salt:slug:userID) по модулю 10000, деленные на 100,
+// то есть число от 0 до 99.99 с шагом 0.01. Та же формула реализована в SQL-функции segment_bucket
+// (см. migrations), поэтому выборку пользователей в сегмент можно пересчитать и проверить офлайн.
+package bucket
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+)
+
+// Of возвращает корзину пользователя для сегмента в диапазоне [0, 100)
+func Of(salt, slug string, userID int) float64 {
+	sum := md5.Sum([]byte(salt + ":" + slug + ":" + strconv.Itoa(userID)))
+	return float64(binary.BigEndian.Uint32(sum[:4])%10000) / 100
+}
+
+// Contains сообщает, попадает ли пользователь в первые percentage процентов пользователей сегмента
+func Contains(salt, slug string, userID int, percentage float64) bool {
+	return Of(salt, slug, userID) < percentage
+}
@@ -0,0 +1,41 @@
+package bucket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOf(t *testing.T) {
+	assertion := assert.New(t)
+
+	// Ожидаемые значения: ('x' || substr(md5('salt:AVITO_SALE_10:1'), 1, 8))::bit(32)::bigint % 10000 / 100.0
+	assertion.Equal(76.81, Of("salt", "AVITO_SALE_10", 1))
+	assertion.Equal(38.75, Of("salt", "AVITO_SALE_10", 42))
+	assertion.Equal(Of("salt", "AVITO_SALE_10", 1), Of("salt", "AVITO_SALE_10", 1))
+	assertion.NotEqual(Of("salt", "AVITO_SALE_10", 1), Of("salt", "AVITO_SALE_20", 1))
+	assertion.NotEqual(Of("salt", "AVITO_SALE_10", 1), Of("pepper", "AVITO_SALE_10", 1))
+
+	for userID := 1; userID <= 1000; userID++ {
+		b := Of("salt", "AVITO_SALE_10", userID)
+		assertion.GreaterOrEqual(b, 0.0)
+		assertion.Less(b, 100.0)
+	}
+}
+
+func TestContains(t *testing.T) {
+	assertion := assert.New(t)
+
+	inside := 0
+	for userID := 1; userID <= 10000; userID++ {
+		// Пользователь из меньшего процента всегда остается и в большем
+		if Contains("salt", "AVITO_SALE_10", userID, 10) {
+			assertion.True(Contains("salt", "AVITO_SALE_10", userID, 50))
+			inside++
+		}
+		assertion.False(Contains("salt", "AVITO_SALE_10", userID, 0))
+		assertion.True(Contains("salt", "AVITO_SALE_10", userID, 100))
+	}
+
+	assertion.InDelta(1000, inside, 100)
+}
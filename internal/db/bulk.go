@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+)
+
+// bulkChunkSize количество пользователей, изменяемых одной транзакцией при массовом изменении сегментов
+const bulkChunkSize = 1000
+
+// maxBulkFailures ограничивает количество ошибок по отдельным пользователям в ответе; остальные только подсчитываются
+const maxBulkFailures = 1000
+
+// Причины, по которым пользователь не добавлен в сегмент при массовом изменении
+const (
+	bulkUserNotFound     = "user does not exist"
+	bulkUserInHoldout    = "user is in holdout"
+	bulkExclusionFailure = "already in segment '%s' of exclusion group '%s'"
+)
+
+// bulkSegment добавляемый сегмент вместе с его группой исключения
+type bulkSegment struct {
+	models.Segment
+	exclusionGroup sql.NullString
+}
+
+// BulkUpdateUserSegments добавляет пользователей в сегменты addList и удаляет их из сегментов removeList.
+// Пользователи обрабатываются частями по bulkChunkSize, каждая часть – отдельной транзакцией с ограничением PG_QUERY_TIMEOUT,
+// изменения и записи истории выполняются запросами над всей частью. Отсутствующие пользователи, пользователи holdout
+// и пользователи, уже состоящие в другом сегменте группы исключения, пропускаются и перечисляются в результате.
+// При ошибке базы данных обработка прерывается, а уже обработанные части остаются примененными; повторный вызов безопасен.
+func (db *DB) BulkUpdateUserSegments(ctx context.Context, userIDs []int, addList []models.Segment, removeList []string) (models.BulkUpdateResult, error) {
+	result := models.BulkUpdateResult{Failures: []models.BulkFailure{}}
+
+	addSegments, err := db.bulkSegments(ctx, addList, removeList)
+	if err != nil {
+		return result, err
+	}
+
+	// Повторяющиеся ID учитываются один раз
+	userIDs = slices.Clone(userIDs)
+	slices.Sort(userIDs)
+	userIDs = slices.Compact(userIDs)
+
+	for start := 0; start < len(userIDs); start += bulkChunkSize {
+		chunk := userIDs[start:min(start+bulkChunkSize, len(userIDs))]
+		if err := db.bulkUpdateChunk(ctx, chunk, addSegments, removeList, &result); err != nil {
+			return result, err
+		}
+		result.Users += len(chunk)
+	}
+
+	return result, nil
+}
+
+// bulkSegments проверяет, что все сегменты существуют и назначаются вручную, а добавляемые сегменты
+// не принадлежат одной группе исключения. Возвращает добавляемые сегменты с их группами исключения.
+func (db *DB) bulkSegments(ctx context.Context, addList []models.Segment, removeList []string) ([]bulkSegment, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	slugs := slices.Clone(removeList)
+	for _, segment := range addList {
+		slugs = append(slugs, segment.Slug)
+	}
+
+	rows, err := db.db.QueryContext(ctx,
+		"SELECT slug, rule IS NOT NULL, exclusion_group FROM segments WHERE slug = ANY($1)",
+		pq.StringArray(slugs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string]sql.NullString, len(slugs))
+	for rows.Next() {
+		var slug string
+		var ruleBased bool
+		var exclusionGroup sql.NullString
+		if err := rows.Scan(&slug, &ruleBased, &exclusionGroup); err != nil {
+			return nil, fmt.Errorf("failed to scan segment: %w", err)
+		}
+		if ruleBased {
+			return nil, newError(ErrConflict, "segment with slug '%s' is rule-based and cannot be assigned manually", slug)
+		}
+		groups[slug] = exclusionGroup
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	for _, slug := range slugs {
+		if _, ok := groups[slug]; !ok {
+			return nil, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+		}
+	}
+
+	segments := make([]bulkSegment, 0, len(addList))
+	occupied := make(map[string]string)
+	for _, segment := range addList {
+		group := groups[segment.Slug]
+		if other, ok := occupied[group.String]; ok && group.Valid && other != segment.Slug {
+			return nil, newError(ErrValidation, "segments '%s' and '%s' belong to the same exclusion group '%s'",
+				other, segment.Slug, group.String)
+		}
+		if group.Valid {
+			occupied[group.String] = segment.Slug
+		}
+		segments = append(segments, bulkSegment{Segment: segment, exclusionGroup: group})
+	}
+
+	return segments, nil
+}
+
+// bulkUpdateChunk изменяет сегменты части пользователей одной транзакцией и добавляет итоги в result
+func (db *DB) bulkUpdateChunk(ctx context.Context, userIDs []int, addList []bulkSegment, removeList []string, result *models.BulkUpdateResult) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	ids := pq.Array(userIDs)
+	var failures []models.BulkFailure
+
+	// Отсутствующие пользователи
+	err = queryFailures(ctx, tx, &failures, func(userID int, _ string) models.BulkFailure {
+		return models.BulkFailure{UserID: userID, Error: bulkUserNotFound}
+	}, `SELECT ids.id, '' FROM unnest($1::INTEGER[]) AS ids(id)
+        WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = ids.id)`, ids)
+	if err != nil {
+		return err
+	}
+
+	// Удаление выполняется до добавления, чтобы в одном запросе можно было заменить сегмент группы исключения
+	if len(removeList) > 0 {
+		removed, err := deleteUserSegments(ctx, tx,
+			`SELECT ids.id, slugs.slug FROM unnest($1::INTEGER[]) AS ids(id) CROSS JOIN unnest($2::TEXT[]) AS slugs(slug)`,
+			ids, pq.StringArray(removeList),
+		)
+		if err != nil {
+			return err
+		}
+		result.Removed += removed
+	}
+
+	for _, segment := range addList {
+		slug := segment.Slug
+
+		// Пользователи holdout не добавляются в сегмент (insertUserSegments пропускает их сам)
+		err = queryFailures(ctx, tx, &failures, func(userID int, _ string) models.BulkFailure {
+			return models.BulkFailure{UserID: userID, Segment: slug, Error: bulkUserInHoldout}
+		}, `SELECT u.id, '' FROM users u WHERE u.id = ANY($1) AND in_holdout($2, $3, u.id)`,
+			ids, db.salt, segment.exclusionGroup)
+		if err != nil {
+			return err
+		}
+
+		// Пользователи, уже состоящие в другом сегменте группы исключения
+		if segment.exclusionGroup.Valid {
+			group := segment.exclusionGroup.String
+			err = queryFailures(ctx, tx, &failures, func(userID int, occupiedSlug string) models.BulkFailure {
+				return models.BulkFailure{UserID: userID, Segment: slug, Error: fmt.Sprintf(bulkExclusionFailure, occupiedSlug, group)}
+			}, `SELECT us.user_id, us.segment_slug FROM user_segments us
+                WHERE us.user_id = ANY($1) AND us.exclusion_group = $2 AND us.segment_slug <> $3
+                  AND NOT in_holdout($4, us.exclusion_group, us.user_id)`,
+				ids, group, slug, db.salt)
+			if err != nil {
+				return err
+			}
+		}
+
+		added, err := db.insertUserSegments(ctx, tx,
+			`SELECT u.id, s.slug, $3::TIMESTAMP FROM users u JOIN segments s ON s.slug = $2
+             WHERE u.id = ANY($1)
+               AND NOT EXISTS (SELECT 1 FROM user_segments us
+                               WHERE us.user_id = u.id AND us.exclusion_group = s.exclusion_group AND us.segment_slug <> s.slug)`,
+			ids, slug, nullTime(segment.ExpirationDate),
+		)
+		if err != nil {
+			return err
+		}
+		result.Added += added
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	result.FailureCount += len(failures)
+	for _, failure := range failures {
+		if len(result.Failures) == maxBulkFailures {
+			break
+		}
+		result.Failures = append(result.Failures, failure)
+	}
+
+	return nil
+}
+
+// queryFailures добавляет в failures ошибки по пользователям, выбранным запросом строк (user_id, подробности)
+func queryFailures(ctx context.Context, tx *sql.Tx, failures *[]models.BulkFailure, failure func(userID int, detail string) models.BulkFailure,
+	query string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query skipped users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var detail string
+		if err := rows.Scan(&userID, &detail); err != nil {
+			return fmt.Errorf("failed to scan skipped user: %w", err)
+		}
+		*failures = append(*failures, failure(userID, detail))
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return nil
+}
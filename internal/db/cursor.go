@@ -0,0 +1,30 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// encodeCursor кодирует позицию постраничного вывода в непрозрачную для клиента строку
+func encodeCursor(position interface{}) (string, error) {
+	raw, err := json.Marshal(position)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor декодирует позицию постраничного вывода, полученную от encodeCursor
+func decodeCursor(cursor string, position interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(raw, position)
+	}
+	if err != nil {
+		return newError(ErrValidation, "invalid cursor")
+	}
+
+	return nil
+}
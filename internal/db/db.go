@@ -1,56 +1,233 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 
+	"github.com/lib/pq"
+
 	"user-segmentation-service/internal/models"
+	"user-segmentation-service/internal/report"
+	"user-segmentation-service/internal/rule"
 )
 
 type DB struct {
-	db *sql.DB
+	db      *sql.DB
+	salt    string         // соль для детерминированного распределения пользователей по сегментам
+	timeout time.Duration  // ограничение времени одной операции; 0 – без ограничения
+	reports report.Storage // хранилище файлов отчетов
+}
+
+func NewDB(sqlDB *sql.DB, salt string, timeout time.Duration, reports report.Storage) *DB {
+	return &DB{db: sqlDB, salt: salt, timeout: timeout, reports: reports}
 }
 
-func NewDB(sqlDB *sql.DB) *DB {
-	return &DB{db: sqlDB}
+// withTimeout ограничивает время операции. Операция также прерывается при отмене ctx,
+// например когда клиент разорвал соединение или сервер останавливается.
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.timeout)
 }
 
 type InterfaceDB interface {
-	CreateUser(name string) (int64, error)
-	DeleteUser(userID int) (int, error)
-	CreateSegment(slug string, randomPercentage float64, expirationDate time.Time) error
-	DeleteSegment(slug string) (int, error)
-	UpdateUserSegments(userID int, addList []models.Segment, removeList []string) (int, error)
-	GetUserSegments(userID int) (int, []string, error)
-	GetUserReport(userID int, yearMonth string) (string, error)
+	CreateUser(ctx context.Context, user models.User) (int64, error)
+	CreateUsers(ctx context.Context, users []models.User) ([]int64, error)
+	GetUser(ctx context.Context, userID int) (models.UserDetails, error)
+	ListUsers(ctx context.Context, query models.UsersQuery) (models.UsersPage, error)
+	UpdateUserAttributes(ctx context.Context, userID int, attributes map[string]interface{}) (models.MembershipChanges, error)
+	GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error)
+	SampleUserAttributes(ctx context.Context, limit int) ([]models.UserAttributes, error)
+	GetAttributeSchema(ctx context.Context) (rule.Schema, error)
+	SetAttributeType(ctx context.Context, name string, attributeType rule.Type) error
+	DeleteUser(ctx context.Context, userID int) (int, error)
+	CreateSegment(ctx context.Context, segment models.Segment) error
+	GetSegment(ctx context.Context, slug string) (models.SegmentDetails, error)
+	ListSegments(ctx context.Context, query models.SegmentsQuery) (models.SegmentsPage, error)
+	ListSegmentMembers(ctx context.Context, query models.SegmentMembersQuery) (models.SegmentMembersPage, error)
+	StreamSegmentMembers(ctx context.Context, slug string, fn func(models.SegmentMember) error) error
+	ListSegmentHistory(ctx context.Context, query models.SegmentHistoryQuery) (models.SegmentHistoryPage, error)
+	GetSegmentDailyHistory(ctx context.Context, slug string, period models.ReportPeriod) ([]models.SegmentDay, error)
+	GetSegmentReport(ctx context.Context, slug string, period models.ReportPeriod) (string, error)
+	UpdateSegment(ctx context.Context, slug string, update models.UpdateSegmentRequest) (models.MembershipChanges, error)
+	DeleteSegment(ctx context.Context, slug string) (int, error)
+	UpdateUserSegments(ctx context.Context, userID int, addList []models.Segment, removeList []string) (int, error)
+	BulkUpdateUserSegments(ctx context.Context, userIDs []int, addList []models.Segment, removeList []string) (models.BulkUpdateResult, error)
+	ImportSegmentUsers(ctx context.Context, slug string, replace bool, r io.Reader) (models.ImportResult, error)
+	GetUserSegments(ctx context.Context, userID int, includeExpired bool) (int, []models.UserSegment, error)
+	GetUsersSegments(ctx context.Context, userIDs []int, includeExpired bool) (map[int][]models.UserSegment, []int, error)
+	GetUserHoldouts(ctx context.Context, userID int) ([]string, error)
+	SetHoldout(ctx context.Context, exclusionGroup string, percentage float64) (int, error)
+	GetHoldouts(ctx context.Context) ([]models.Holdout, error)
+	GetUserReport(ctx context.Context, userID int, period models.ReportPeriod) (string, error)
+	CreateReportJob(ctx context.Context, job models.ReportJob) (models.ReportJob, error)
+	GetReportJob(ctx context.Context, jobID int) (models.ReportJob, error)
+	ClaimReportJob(ctx context.Context, lease time.Duration) (models.ReportJob, bool, error)
+	ExtendReportJobLease(ctx context.Context, job models.ReportJob, lease time.Duration) (bool, error)
+	RunReportJob(ctx context.Context, job models.ReportJob) error
+	RequeueExpiredReportJobs(ctx context.Context) (int, error)
+	DeleteExpiredUserSegments(ctx context.Context, batchSize int) (int, error)
+	CreateRollout(ctx context.Context, slug string, steps []models.RolloutStep) (models.Rollout, error)
+	GetRollout(ctx context.Context, slug string) (models.Rollout, error)
+	SetRolloutStatus(ctx context.Context, slug, status string) (models.Rollout, error)
+	ListDueRollouts(ctx context.Context) ([]int, error)
+	ApplyRolloutSteps(ctx context.Context, rolloutID int) (bool, error)
 }
 
-func (db *DB) CreateUser(name string) (int64, error) {
-	var userID int64
+func (db *DB) CreateUser(ctx context.Context, user models.User) (int64, error) {
+	userIDs, err := db.CreateUsers(ctx, []models.User{user})
+	if err != nil {
+		return 0, err
+	}
 
-	// Вставляем пользователя в базу данных и получаем его ID.
-	err := db.db.QueryRow(
-		"INSERT INTO users(name) VALUES($1) RETURNING id",
-		name,
-	).Scan(&userID)
+	return userIDs[0], nil
+}
 
+// CreateUsers создает пользователей одной транзакцией и добавляет их в активные процентные сегменты
+// и сегменты с правилами, которым соответствуют их атрибуты
+func (db *DB) CreateUsers(ctx context.Context, users []models.User) ([]int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	names := make([]string, 0, len(users))
+	attributes := make([]string, 0, len(users))
+	for _, user := range users {
+		encoded, err := encodeAttributes(user.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, user.Name)
+		attributes = append(attributes, encoded)
+	}
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create user: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
 
-	return userID, nil
+	// Проверка атрибутов по схеме
+	userAttributes := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		userAttributes = append(userAttributes, user.Attributes)
+	}
+	if err := validateAttributes(ctx, tx, userAttributes...); err != nil {
+		return nil, err
+	}
+
+	// Вставляем пользователей в базу данных и получаем их ID.
+	rows, err := tx.QueryContext(ctx,
+		"INSERT INTO users(name, attributes) SELECT * FROM unnest($1::text[], $2::jsonb[]) RETURNING id",
+		pq.Array(names),
+		pq.Array(attributes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	defer rows.Close()
+
+	userIDs := make([]int64, 0, len(names))
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan created user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	// Новые пользователи должны попадать в процентные сегменты наравне с существующими
+	if err := db.enrollUsers(ctx, tx, userIDs); err != nil {
+		return nil, err
+	}
+	if _, err := db.applyUserRules(ctx, tx, userIDs); err != nil {
+		return nil, err
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+// UpdateUserAttributes объединяет атрибуты пользователя с переданными (null удаляет атрибут)
+// и пересчитывает его участие в сегментах с правилами
+func (db *DB) UpdateUserAttributes(ctx context.Context, userID int, attributes map[string]interface{}) (models.MembershipChanges, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var changes models.MembershipChanges
+
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return changes, err
+	}
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return changes, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	// Проверка атрибутов по схеме
+	if err := validateAttributes(ctx, tx, attributes); err != nil {
+		return changes, err
+	}
+
+	// Обновление атрибутов с проверкой существования пользователя
+	var existingUserId int
+	err = tx.QueryRowContext(ctx,
+		"UPDATE users SET attributes = jsonb_strip_nulls(attributes || $2::jsonb) WHERE id = $1 RETURNING id",
+		userID,
+		encoded,
+	).Scan(&existingUserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return changes, newError(ErrNotFound, "user with ID '%d' does not exist", userID)
+	} else if err != nil {
+		return changes, fmt.Errorf("failed to update attributes of user with ID '%d': %w", userID, err)
+	}
+
+	changes, err = db.applyUserRules(ctx, tx, []int64{int64(userID)})
+	if err != nil {
+		return changes, err
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return changes, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changes, nil
 }
 
-func (db *DB) DeleteUser(userID int) (int, error) {
+func (db *DB) DeleteUser(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	// Начало транзакции
-	tx, err := db.db.Begin()
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to start transaction: %w", err)
 	}
@@ -62,16 +239,16 @@ func (db *DB) DeleteUser(userID int) (int, error) {
 
 	// Проверка существования пользователя в базе данных
 	var existingId int
-	err = tx.QueryRow("SELECT id FROM users WHERE id = $1", userID).Scan(&existingId)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1", userID).Scan(&existingId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("user with ID %d does not exist", userID)
+			return 0, newError(ErrNotFound, "user with ID %d does not exist", userID)
 		}
 		return 0, fmt.Errorf("failed to query user with ID %d: %w", userID, err)
 	}
 
 	// Удаление сегментов пользователя
-	if _, err = tx.Exec(
+	if _, err = tx.ExecContext(ctx,
 		"DELETE FROM user_segments WHERE user_id=$1",
 		userID,
 	); err != nil {
@@ -79,7 +256,7 @@ func (db *DB) DeleteUser(userID int) (int, error) {
 	}
 
 	// Удаление самого пользователя
-	if _, err = tx.Exec(
+	if _, err = tx.ExecContext(ctx,
 		"DELETE FROM users WHERE id=$1",
 		userID,
 	); err != nil {
@@ -94,19 +271,36 @@ func (db *DB) DeleteUser(userID int) (int, error) {
 	return userID, nil
 }
 
-func (db *DB) CreateSegment(slug string, randomPercentage float64, expirationDate time.Time) error {
+func (db *DB) CreateSegment(ctx context.Context, segment models.Segment) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	slug, randomPercentage, expirationDate := segment.Slug, segment.RandomPercentage, segment.ExpirationDate
+
+	bucketing := segment.Bucketing
+	if bucketing == "" {
+		bucketing = models.BucketingRandom
+	}
+	if bucketing != models.BucketingRandom && bucketing != models.BucketingHash {
+		return newError(ErrValidation, "unknown bucketing '%s'", bucketing)
+	}
+
+	// Участники сегмента с правилом определяются только атрибутами пользователей
+	if segment.Rule != "" && randomPercentage > 0 {
+		return newError(ErrValidation, "rule and random percentage cannot be combined")
+	}
 
 	if expirationDate.IsZero() {
-		return fmt.Errorf("expirationDate should not be zero")
+		return newError(ErrValidation, "expirationDate should not be zero")
 	}
 
 	currentTime := time.Now()
 	if expirationDate.Before(currentTime.Add(1 * time.Hour)) {
-		return fmt.Errorf("expirationDate should be at least 1 hours in the future")
+		return newError(ErrValidation, "expirationDate should be at least 1 hours in the future")
 	}
 
 	// Начало транзакции
-	tx, err := db.db.Begin()
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -118,74 +312,154 @@ func (db *DB) CreateSegment(slug string, randomPercentage float64, expirationDat
 
 	// Проверка на существование сегмента с таким же slug
 	var existingId int
-	err = tx.QueryRow("SELECT id FROM segments WHERE slug = $1", slug).Scan(&existingId)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM segments WHERE slug = $1", slug).Scan(&existingId)
 	if !errors.Is(err, sql.ErrNoRows) {
 		if err != nil {
 			return fmt.Errorf("failed to query existing segment: %w", err)
 		}
 
-		return fmt.Errorf("segment with slug '%s' already exists", slug)
+		return newError(ErrAlreadyExists, "segment with slug '%s' already exists", slug)
 	}
 
-	// Вставка нового сегмента
-	_, err = tx.Exec("INSERT INTO segments(slug) VALUES($1)", slug)
+	// Проверка правила по схеме атрибутов
+	var expr rule.Expr
+	if segment.Rule != "" {
+		if expr, err = compileRule(ctx, tx, segment.Rule); err != nil {
+			return err
+		}
+	}
+
+	// Вставка нового сегмента вместе с параметрами, по которым в него попадают новые пользователи
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO segments(slug, bucketing, random_percentage, expiration_date, rule, exclusion_group, tags)
+         VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		slug, bucketing, randomPercentage, expirationDate, sql.NullString{String: segment.Rule, Valid: expr != nil},
+		sql.NullString{String: segment.ExclusionGroup, Valid: segment.ExclusionGroup != ""},
+		pq.StringArray(append([]string{}, segment.Tags...)),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to insert new segment: %w", err)
 	}
 
-	// Получение общего числа пользователей
-	var totalUsers int
-	err = tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
-	if err != nil {
-		return fmt.Errorf("failed to count total users: %w", err)
+	// Варианты сохраняются до добавления пользователей, так как вариант назначается при добавлении
+	for i, variant := range segment.Variants {
+		if _, err = tx.ExecContext(ctx,
+			"INSERT INTO segment_variants(segment_slug, name, weight, position) VALUES($1, $2, $3, $4)",
+			slug, variant.Name, variant.Weight, i,
+		); err != nil {
+			return fmt.Errorf("failed to insert variant '%s': %w", variant.Name, err)
+		}
 	}
 
-	// Вычисление числа пользователей для добавления в сегмент
-	numUsersToAdd := int(float64(totalUsers) * (randomPercentage / 100.0))
+	// Добавление пользователей в сегмент
+	if expr != nil {
+		_, err = db.applySegmentRule(ctx, tx, slug, expr)
+	} else if bucketing == models.BucketingHash {
+		// Пользователь попадает в сегмент, если его корзина меньше указанного процента,
+		// поэтому выборка воспроизводима и может быть пересчитана для любого пользователя
+		_, err = db.insertUserSegments(ctx, tx,
+			`SELECT u.id, s.slug, s.expiration_date FROM users u JOIN segments s ON s.slug = $1
+             WHERE segment_bucket($2, s.slug, u.id) < s.random_percentage`,
+			slug, db.salt,
+		)
+	} else {
+		// Получение общего числа пользователей
+		var totalUsers int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&totalUsers)
+		if err != nil {
+			return fmt.Errorf("failed to count total users: %w", err)
+		}
+
+		// Вычисление числа пользователей для добавления в сегмент
+		numUsersToAdd := int(float64(totalUsers) * (randomPercentage / 100.0))
 
-	// Создание временной таблицы
-	_, err = tx.Exec("CREATE TEMP TABLE temp_users AS SELECT id FROM users ORDER BY RANDOM() LIMIT $1", numUsersToAdd)
+		_, err = db.insertUserSegments(ctx, tx,
+			`SELECT u.id, s.slug, s.expiration_date FROM users u JOIN segments s ON s.slug = $1
+             WHERE NOT EXISTS (SELECT 1 FROM user_segments us WHERE us.user_id = u.id AND us.exclusion_group = s.exclusion_group)
+               AND NOT in_holdout($3, s.exclusion_group, u.id)
+             ORDER BY RANDOM() LIMIT $2`,
+			slug, numUsersToAdd, db.salt,
+		)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create temp table: %w", err)
+		return fmt.Errorf("failed to add users to segment: %w", err)
 	}
 
-	// Добавление пользователей в сегмент
-	_, err = tx.Exec(
-		`INSERT INTO user_segments(user_id, segment_slug, expiration_date)
-         SELECT id, $1, $2 FROM temp_users`,
-		slug, expirationDate,
-	)
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSegment изменяет параметры сегмента, добавляя или удаляя только затронутых изменением пользователей
+func (db *DB) UpdateSegment(ctx context.Context, slug string, update models.UpdateSegmentRequest) (models.MembershipChanges, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var changes models.MembershipChanges
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to add users to segment: %w", err)
+		return changes, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
 
-	// Запись в историю
-	_, err = tx.Exec(
-		`INSERT INTO user_segment_history(user_id, segment_slug, operation)
-         SELECT id, $1, 'add' FROM temp_users`,
+	// Блокировка сегмента, чтобы параллельные изменения не рассчитывали разницу от устаревшего процента
+	var bucketing string
+	var randomPercentage float64
+	var currentRule sql.NullString
+	err = tx.QueryRowContext(ctx,
+		"SELECT bucketing, random_percentage, rule FROM segments WHERE slug = $1 FOR UPDATE",
 		slug,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to log segment addition: %w", err)
+	).Scan(&bucketing, &randomPercentage, &currentRule)
+	if errors.Is(err, sql.ErrNoRows) {
+		return changes, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+	} else if err != nil {
+		return changes, fmt.Errorf("failed to query existing segment: %w", err)
 	}
 
-	// Удаление временной таблицы
-	_, err = tx.Exec("DROP TABLE temp_users")
-	if err != nil {
-		return fmt.Errorf("failed to drop temp table: %w", err)
+	if update.RandomPercentage != nil {
+		if currentRule.Valid {
+			return changes, newError(ErrConflict, "segment with slug '%s' is rule-based and has no percentage", slug)
+		}
+
+		changes, err = db.setSegmentPercentage(ctx, tx, slug, bucketing, randomPercentage, *update.RandomPercentage)
+		if err != nil {
+			return changes, err
+		}
+	}
+
+	if update.Rule != nil {
+		if randomPercentage > 0 {
+			return changes, newError(ErrConflict, "rule and random percentage cannot be combined")
+		}
+
+		if changes, err = db.setSegmentRule(ctx, tx, slug, *update.Rule); err != nil {
+			return changes, err
+		}
 	}
 
 	// Подтверждение транзакции
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if err = tx.Commit(); err != nil {
+		return changes, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return changes, nil
 }
 
-func (db *DB) DeleteSegment(slug string) (int, error) {
+func (db *DB) DeleteSegment(ctx context.Context, slug string) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	// Начало транзакции
-	tx, err := db.db.Begin()
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -197,21 +471,21 @@ func (db *DB) DeleteSegment(slug string) (int, error) {
 
 	// Проверка наличия сегмента в базе данных
 	var existingId int
-	err = tx.QueryRow("SELECT id FROM segments WHERE slug = $1", slug).Scan(&existingId)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM segments WHERE slug = $1", slug).Scan(&existingId)
 	if errors.Is(err, sql.ErrNoRows) {
-		return 0, fmt.Errorf("segment with slug '%s' does not exist", slug)
+		return 0, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
 	} else if err != nil {
 		return 0, fmt.Errorf("failed to query existing segment: %w", err)
 	}
 
 	// Удаление записей о сегменте из таблицы user_segments
-	if _, err = tx.Exec("DELETE FROM user_segments WHERE segment_slug = $1", slug); err != nil {
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_segments WHERE segment_slug = $1", slug); err != nil {
 		return 0, fmt.Errorf("failed to delete segment from user_segments: %w", err)
 	}
 
 	var segmentId int
 	// Удаление сегмента из таблицы segments и возвращение его ID
-	err = tx.QueryRow("DELETE FROM segments WHERE slug=$1 RETURNING id", slug).Scan(&segmentId)
+	err = tx.QueryRowContext(ctx, "DELETE FROM segments WHERE slug=$1 RETURNING id", slug).Scan(&segmentId)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete segment: %w", err)
 	}
@@ -224,9 +498,12 @@ func (db *DB) DeleteSegment(slug string) (int, error) {
 	return segmentId, nil
 }
 
-func (db *DB) UpdateUserSegments(userID int, addList []models.Segment, removeList []string) (int, error) {
+func (db *DB) UpdateUserSegments(ctx context.Context, userID int, addList []models.Segment, removeList []string) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	// Начинаем транзакцию
-	tx, err := db.db.Begin()
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -238,66 +515,97 @@ func (db *DB) UpdateUserSegments(userID int, addList []models.Segment, removeLis
 
 	// Проверка существования пользователя
 	var existingUserId int
-	err = tx.QueryRow("SELECT id FROM users WHERE id = $1", userID).Scan(&existingUserId)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1", userID).Scan(&existingUserId)
 	if errors.Is(err, sql.ErrNoRows) {
-		return 0, fmt.Errorf("user with ID '%d' does not exist", userID)
+		return 0, newError(ErrNotFound, "user with ID '%d' does not exist", userID)
 	} else if err != nil {
 		return 0, fmt.Errorf("failed to query existing user: %w", err)
 	}
 
-	// Добавляем сегменты
-	for _, segment := range addList {
+	// Удаляем сегменты до добавления, чтобы в одном запросе можно было заменить сегмент группы исключения.
+	// Запросы с сегментом в обоих списках отклоняет обработчик, поэтому порядок не меняет их результат.
+	for _, slug := range removeList {
 		var existingSlug string
-		err = tx.QueryRow("SELECT slug FROM segments WHERE slug = $1", segment.Slug).Scan(&existingSlug)
+		var segmentRule sql.NullString
+		err = tx.QueryRowContext(ctx, "SELECT slug, rule FROM segments WHERE slug = $1", slug).Scan(&existingSlug, &segmentRule)
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("segment with slug '%s' does not exist", segment.Slug)
+			return 0, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
 		} else if err != nil {
 			return 0, fmt.Errorf("failed to query existing segment: %w", err)
 		}
+		if segmentRule.Valid {
+			return 0, newError(ErrConflict, "segment with slug '%s' is rule-based and cannot be assigned manually", slug)
+		}
 
-		if _, err = tx.Exec(
-			`INSERT INTO user_segments(user_id, segment_slug, expiration_date) VALUES($1, $2, $3)
-             ON CONFLICT (user_id, segment_slug) DO NOTHING`,
+		var variant sql.NullString
+		err = tx.QueryRowContext(ctx,
+			"DELETE FROM user_segments WHERE user_id=$1 AND segment_slug=$2 RETURNING variant",
 			userID,
-			segment.Slug,
-			segment.ExpirationDate,
-		); err != nil {
-			return 0, fmt.Errorf("failed to add segment '%s': %w", segment.Slug, err)
+			slug,
+		).Scan(&variant)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("failed to remove segment '%s': %w", slug, err)
 		}
 
-		if _, err = tx.Exec(
-			"INSERT INTO user_segment_history(user_id, segment_slug, operation, operation_date) VALUES($1, $2, 'add', NOW())",
+		if _, err = tx.ExecContext(ctx,
+			"INSERT INTO user_segment_history(user_id, segment_slug, operation, operation_date, variant) VALUES($1, $2, 'remove', NOW(), $3)",
 			userID,
-			segment.Slug,
+			slug,
+			variant,
 		); err != nil {
-			return 0, fmt.Errorf("failed to add history record for segment '%s': %w", segment.Slug, err)
+			return 0, fmt.Errorf("failed to add history record for segment '%s': %w", slug, err)
 		}
 	}
 
-	// Удаляем сегменты
-	for _, slug := range removeList {
+	// Добавляем сегменты
+	for _, segment := range addList {
 		var existingSlug string
-		err = tx.QueryRow("SELECT slug FROM segments WHERE slug = $1", slug).Scan(&existingSlug)
+		var segmentRule, exclusionGroup sql.NullString
+		err = tx.QueryRowContext(ctx, "SELECT slug, rule, exclusion_group FROM segments WHERE slug = $1", segment.Slug).Scan(
+			&existingSlug, &segmentRule, &exclusionGroup)
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("segment with slug '%s' does not exist", slug)
+			return 0, newError(ErrNotFound, "segment with slug '%s' does not exist", segment.Slug)
 		} else if err != nil {
 			return 0, fmt.Errorf("failed to query existing segment: %w", err)
 		}
+		if segmentRule.Valid {
+			return 0, newError(ErrConflict, "segment with slug '%s' is rule-based and cannot be assigned manually", segment.Slug)
+		}
 
-		if _, err = tx.Exec(
-			"DELETE FROM user_segments WHERE user_id=$1 AND segment_slug=$2",
+		// Пользователь holdout не добавляется ни в один сегмент, на который распространяется holdout
+		if err = db.checkHoldout(ctx, tx, userID, segment.Slug, exclusionGroup); err != nil {
+			return 0, err
+		}
+
+		// Пользователь может состоять только в одном сегменте группы исключения
+		if err = checkExclusionGroup(ctx, tx, userID, segment.Slug, exclusionGroup); err != nil {
+			return 0, err
+		}
+
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO user_segments(user_id, segment_slug, expiration_date, exclusion_group, variant)
+             VALUES($1, $2, $3, $4, segment_variant($5, $2, $1))
+             ON CONFLICT (user_id, segment_slug) DO NOTHING`,
 			userID,
-			slug,
+			segment.Slug,
+			nullTime(segment.ExpirationDate),
+			exclusionGroup,
+			db.salt,
 		); err != nil {
-			return 0, fmt.Errorf("failed to remove segment '%s': %w", slug, err)
+			if isExclusionViolation(err) {
+				return 0, newError(ErrConflict, "%w: user with ID '%d' cannot be added to segment '%s', already in another segment of exclusion group '%s'",
+					ErrExclusionConflict, userID, segment.Slug, exclusionGroup.String)
+			}
+			return 0, fmt.Errorf("failed to add segment '%s': %w", segment.Slug, err)
 		}
 
-		if _, err = tx.Exec(
-			"INSERT INTO user_segment_history(user_id, segment_slug, operation, operation_date) VALUES($1, $2, 'remove', NOW())",
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO user_segment_history(user_id, segment_slug, operation, operation_date, variant)
+             SELECT $1, $2, 'add', NOW(), variant FROM user_segments WHERE user_id = $1 AND segment_slug = $2`,
 			userID,
-			slug,
+			segment.Slug,
 		); err != nil {
-			return 0, fmt.Errorf("failed to add history record for segment '%s': %w", slug, err)
+			return 0, fmt.Errorf("failed to add history record for segment '%s': %w", segment.Slug, err)
 		}
 	}
 
@@ -309,9 +617,14 @@ func (db *DB) UpdateUserSegments(userID int, addList []models.Segment, removeLis
 	return userID, nil
 }
 
-func (db *DB) GetUserSegments(userID int) (int, []string, error) {
+// GetUserSegments возвращает сегменты пользователя. Просроченные, но еще не удаленные фоновой очисткой
+// сегменты возвращаются только при includeExpired.
+func (db *DB) GetUserSegments(ctx context.Context, userID int, includeExpired bool) (int, []models.UserSegment, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	// Начало транзакции
-	tx, err := db.db.Begin()
+	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -323,31 +636,41 @@ func (db *DB) GetUserSegments(userID int) (int, []string, error) {
 
 	// Проверка наличия пользователя в базе данных
 	var existingUserId int
-	err = tx.QueryRow("SELECT id FROM users WHERE id = $1", userID).Scan(&existingUserId)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1", userID).Scan(&existingUserId)
 	if errors.Is(err, sql.ErrNoRows) {
-		return 0, nil, fmt.Errorf("user with ID '%d' does not exist", userID)
+		return 0, nil, newError(ErrNotFound, "user with ID '%d' does not exist", userID)
 	} else if err != nil {
 		return 0, nil, fmt.Errorf("failed to query existing user: %w", err)
 	}
 
 	// Запрос на получение сегментов пользователя
-	rows, err := tx.Query(
-		"SELECT s.slug FROM segments s JOIN user_segments us ON s.slug = us.segment_slug WHERE us.user_id = $1",
+	rows, err := tx.QueryContext(ctx,
+		`SELECT s.slug, us.added_at, us.expiration_date, us.exclusion_group, us.variant
+         FROM segments s JOIN user_segments us ON s.slug = us.segment_slug
+         WHERE us.user_id = $1 AND ($2 OR us.expiration_date IS NULL OR us.expiration_date > NOW())
+         ORDER BY us.added_at, s.slug`,
 		userID,
+		includeExpired,
 	)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to query segments for user ID '%d': %w", userID, err)
 	}
 	defer rows.Close()
 
-	var segments []string
+	var segments []models.UserSegment
 	// Обход результатов запроса и добавление их в массив segments
 	for rows.Next() {
-		var slug string
-		if err := rows.Scan(&slug); err != nil {
+		var segment models.UserSegment
+		var expirationDate sql.NullTime
+		var exclusionGroup, variant sql.NullString
+		if err := rows.Scan(&segment.Slug, &segment.AddedAt, &expirationDate, &exclusionGroup, &variant); err != nil {
 			return 0, nil, fmt.Errorf("failed to scan row for user ID '%d': %w", userID, err)
 		}
-		segments = append(segments, slug)
+		segment.ExclusionGroup, segment.Variant = exclusionGroup.String, variant.String
+		if expirationDate.Valid {
+			segment.ExpirationDate = &expirationDate.Time
+		}
+		segments = append(segments, segment)
 	}
 
 	// Проверка наличия дополнительных ошибок, произошедших при получении всех строк запроса
@@ -363,84 +686,125 @@ func (db *DB) GetUserSegments(userID int) (int, []string, error) {
 	return userID, segments, nil
 }
 
-func (db *DB) GetUserReport(userID int, yearMonth string) (string, error) {
-	// Начало транзакции
-	tx, err := db.db.Begin()
+// GetUsersSegments возвращает сегменты нескольких пользователей одним запросом: для каждого существующего пользователя
+// (в том числе без сегментов) – его сегменты, как в GetUserSegments, и отдельно – отсутствующие ID по возрастанию.
+func (db *DB) GetUsersSegments(ctx context.Context, userIDs []int, includeExpired bool) (map[int][]models.UserSegment, []int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Повторяющиеся ID учитываются один раз
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT ids.id, u.id IS NOT NULL, us.segment_slug, us.added_at, us.expiration_date, us.exclusion_group, us.variant
+         FROM (SELECT DISTINCT unnest($1::INTEGER[]) AS id) ids
+         LEFT JOIN users u ON u.id = ids.id
+         LEFT JOIN user_segments us ON us.user_id = u.id
+             AND ($2 OR us.expiration_date IS NULL OR us.expiration_date > NOW())
+         ORDER BY ids.id, us.added_at, us.segment_slug`,
+		pq.Array(userIDs),
+		includeExpired,
+	)
 	if err != nil {
-		return "", fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, nil, fmt.Errorf("failed to query segments for user IDs: %w", err)
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+	defer rows.Close()
+
+	segments := make(map[int][]models.UserSegment, len(userIDs))
+	unknown := []int{}
+	for rows.Next() {
+		var userID int
+		var exists bool
+		var slug, exclusionGroup, variant sql.NullString
+		var addedAt, expirationDate sql.NullTime
+		if err := rows.Scan(&userID, &exists, &slug, &addedAt, &expirationDate, &exclusionGroup, &variant); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-	}()
 
-	// Проверка наличия пользователя в базе данных
-	var existingUserId int
-	err = tx.QueryRow("SELECT id FROM users WHERE id = $1", userID).Scan(&existingUserId)
-	if errors.Is(err, sql.ErrNoRows) {
-		return "", fmt.Errorf("user with ID '%d' does not exist", userID)
-	} else if err != nil {
-		return "", fmt.Errorf("failed to query existing user: %w", err)
-	}
+		if !exists {
+			unknown = append(unknown, userID)
+			continue
+		}
+		if _, ok := segments[userID]; !ok {
+			segments[userID] = []models.UserSegment{}
+		}
+		// Пользователь без сегментов возвращается одной строкой без сегмента
+		if !slug.Valid {
+			continue
+		}
 
-	// Создание директории для отчетов, если она не существует
-	err = os.MkdirAll("reports", os.ModePerm)
-	if err != nil {
-		return "", fmt.Errorf("failed to create reports directory: %w", err)
+		segment := models.UserSegment{
+			Slug:           slug.String,
+			AddedAt:        addedAt.Time,
+			ExclusionGroup: exclusionGroup.String,
+			Variant:        variant.String,
+		}
+		if expirationDate.Valid {
+			segment.ExpirationDate = &expirationDate.Time
+		}
+		segments[userID] = append(segments[userID], segment)
 	}
 
-	// Создание CSV файла
-	fileName := fmt.Sprintf("user_%d_report_%s.csv", userID, yearMonth)
-	file, err := os.Create(filepath.Join("reports", fileName))
-	if err != nil {
-		return "", fmt.Errorf("failed to create CSV file for user ID '%d' and year-month '%s': %w", userID, yearMonth, err)
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error occurred while reading rows: %w", err)
 	}
-	defer file.Close()
 
-	// Инициализация CSV writer
-	w := csv.NewWriter(file)
-	defer w.Flush()
+	return segments, unknown, nil
+}
 
-	// Запись заголовков CSV файла
-	if err := w.Write([]string{"User ID", "Segment Slug", "Operation", "Operation Date"}); err != nil {
-		return "", fmt.Errorf("failed to write headers to CSV: %w", err)
-	}
+// GetUserReport создает CSV отчет по истории сегментов пользователя за период и возвращает ссылку на его скачивание.
+// Даты операций в отчете указываются в часовом поясе периода.
+func (db *DB) GetUserReport(ctx context.Context, userID int, period models.ReportPeriod) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
 
-	// Выборка данных для отчета из базы данных
-	rows, err := tx.Query(
-		`SELECT user_id, segment_slug, operation, operation_date 
-         FROM user_segment_history 
-         WHERE user_id = $1 AND to_char(operation_date, 'YYYY-MM') = $2`,
-		userID,
-		yearMonth,
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to query user_segment_history for user ID '%d' and year-month '%s': %w", userID, yearMonth, err)
+	if err := db.checkUserExists(ctx, userID); err != nil {
+		return "", err
 	}
-	defer rows.Close()
 
-	// Запись данных в CSV файл
-	for rows.Next() {
-		var id int
-		var slug, operation, operationDate string
-		if err := rows.Scan(&id, &slug, &operation, &operationDate); err != nil {
-			return "", fmt.Errorf("failed to scan row for user ID '%d': %w", userID, err)
-		}
-		if err := w.Write([]string{strconv.Itoa(id), slug, operation, operationDate}); err != nil {
-			return "", fmt.Errorf("failed to write row to CSV for user ID '%d': %w", userID, err)
-		}
+	fileName := fmt.Sprintf("user_%d_report_%s.csv", userID, reportPeriodName(period))
+	if _, err := db.writeReport(ctx, fileName, period.Location, nil, userReportEvents, userID, period.From, period.To); err != nil {
+		return "", err
 	}
 
-	// Проверка наличия дополнительных ошибок
-	if err := rows.Err(); err != nil {
-		return "", fmt.Errorf("error occurred while reading rows: %w", err)
+	return db.reports.Link(fileName), nil
+}
+
+// DeleteExpiredUserSegments удаляет не более batchSize просроченных записей о сегментах пользователей
+// и фиксирует их в истории операцией 'expire'. Возвращает количество удаленных записей.
+func (db *DB) DeleteExpiredUserSegments(ctx context.Context, batchSize int) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Удаление и запись в историю выполняются одним запросом, поэтому отдельная транзакция не нужна.
+	// SKIP LOCKED позволяет нескольким экземплярам сервиса очищать таблицу параллельно.
+	res, err := db.db.ExecContext(ctx,
+		`WITH expired AS (
+             SELECT user_id, segment_slug FROM user_segments
+             WHERE expiration_date <= NOW()
+             LIMIT $1
+             FOR UPDATE SKIP LOCKED
+         ), deleted AS (
+             DELETE FROM user_segments us USING expired e
+             WHERE us.user_id = e.user_id AND us.segment_slug = e.segment_slug
+             RETURNING us.user_id, us.segment_slug, us.variant
+         )
+         INSERT INTO user_segment_history(user_id, segment_slug, operation, variant)
+         SELECT user_id, segment_slug, 'expire', variant FROM deleted`,
+		batchSize,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired user segments: %w", err)
 	}
 
-	// Подтверждение транзакции
-	if err = tx.Commit(); err != nil {
-		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of expired user segments: %w", err)
 	}
 
-	return fileName, nil
+	return int(deleted), nil
+}
+
+// nullTime преобразует нулевое время в NULL, чтобы сегмент без TTL не считался просроченным
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
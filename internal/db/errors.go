@@ -0,0 +1,35 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Виды ошибок предметной области. Проверяются через errors.Is, например errors.Is(err, db.ErrNotFound).
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrValidation    = errors.New("validation failed")
+	ErrConflict      = errors.New("conflict")
+)
+
+// Error ошибка предметной области: вид ошибки (Kind) и ошибка с сообщением для клиента (Err).
+// Сообщение ошибки совпадает с сообщением Err.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap позволяет проверять как вид ошибки, так и ошибки, обернутые в Err (например *rule.Error)
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// newError создает ошибку вида kind; format и args – как у fmt.Errorf
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrExclusionConflict возвращается, если пользователь уже состоит в другом сегменте той же группы исключения
+var ErrExclusionConflict = errors.New("exclusion group conflict")
+
+// exclusionGroupKey уникальный индекс, ограничивающий пользователя одним сегментом группы исключения
+const exclusionGroupKey = "user_segments_exclusion_group_key"
+
+// checkExclusionGroup проверяет, что пользователь не состоит в другом сегменте группы исключения
+func checkExclusionGroup(ctx context.Context, tx *sql.Tx, userID int, slug string, group sql.NullString) error {
+	if !group.Valid {
+		return nil
+	}
+
+	var occupiedSlug string
+	err := tx.QueryRowContext(ctx,
+		"SELECT segment_slug FROM user_segments WHERE user_id = $1 AND exclusion_group = $2 AND segment_slug <> $3",
+		userID, group.String, slug,
+	).Scan(&occupiedSlug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to query exclusion group '%s': %w", group.String, err)
+	}
+
+	return exclusionConflict(userID, slug, occupiedSlug, group.String)
+}
+
+// exclusionConflict формирует ошибку конфликта группы исключения
+func exclusionConflict(userID int, slug, occupiedSlug, group string) error {
+	return newError(ErrConflict, "%w: user with ID '%d' cannot be added to segment '%s', already in segment '%s' of exclusion group '%s'",
+		ErrExclusionConflict, userID, slug, occupiedSlug, group)
+}
+
+// isExclusionViolation сообщает, что запись нарушила уникальность группы исключения
+// (например, при одновременном добавлении пользователя в два сегмента группы)
+func isExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == exclusionGroupKey
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"user-segmentation-service/internal/models"
+)
+
+// historyCursor позиция в истории сегмента: дата и ID последнего возвращенного события
+type historyCursor struct {
+	Date time.Time `json:"d"`
+	ID   int64     `json:"i"`
+}
+
+// historyPeriod условие на период истории [$2, $3). Границы передаются моментами времени и переводятся в часовой пояс
+// сеанса, в котором записывается operation_date. Условие задано диапазоном по самому столбцу, поэтому запросы читают
+// только нужную часть индексов (segment_slug, operation_date) и (user_id, operation_date).
+const historyPeriod = `operation_date >= $2::TIMESTAMPTZ::TIMESTAMP AND operation_date < $3::TIMESTAMPTZ::TIMESTAMP`
+
+// segmentEvents выбирает события сегмента $1 за период [$2, $3)
+const segmentEvents = `SELECT id, user_id, operation, operation_date::TIMESTAMPTZ, COALESCE(variant, '')
+         FROM user_segment_history
+         WHERE segment_slug = $1 AND ` + historyPeriod
+
+// ListSegmentHistory возвращает страницу событий добавления, удаления и истечения участия в сегменте за период,
+// отсортированных по дате события. Даты событий указываются в часовом поясе периода.
+func (db *DB) ListSegmentHistory(ctx context.Context, query models.SegmentHistoryQuery) (models.SegmentHistoryPage, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	conditions := ""
+	args := []interface{}{query.Slug, query.Period.From, query.Period.To}
+
+	// Продолжение со следующего после курсора события
+	if query.Cursor != "" {
+		var after historyCursor
+		if err := decodeCursor(query.Cursor, &after); err != nil {
+			return models.SegmentHistoryPage{}, err
+		}
+
+		args = append(args, after.Date, after.ID)
+		conditions = " AND (operation_date, id) > ($4::TIMESTAMPTZ::TIMESTAMP, $5)"
+	}
+
+	if err := db.checkSegmentExists(ctx, query.Slug); err != nil {
+		return models.SegmentHistoryPage{}, err
+	}
+
+	// Выбирается на одно событие больше, чтобы узнать, есть ли следующая страница
+	args = append(args, query.Limit+1)
+	rows, err := db.db.QueryContext(ctx,
+		fmt.Sprintf("%s%s ORDER BY operation_date, id LIMIT $%d", segmentEvents, conditions, len(args)),
+		args...,
+	)
+	if err != nil {
+		return models.SegmentHistoryPage{}, fmt.Errorf("failed to query history of segment '%s': %w", query.Slug, err)
+	}
+	defer rows.Close()
+
+	page := models.SegmentHistoryPage{Events: []models.SegmentEvent{}}
+	var ids []int64
+	for rows.Next() {
+		id, event, err := scanSegmentEvent(rows)
+		if err != nil {
+			return models.SegmentHistoryPage{}, err
+		}
+		event.OperationDate = event.OperationDate.In(query.Period.Location)
+		ids = append(ids, id)
+		page.Events = append(page.Events, event)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return models.SegmentHistoryPage{}, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	if len(page.Events) > query.Limit {
+		page.Events = page.Events[:query.Limit]
+
+		last := len(page.Events) - 1
+		after := historyCursor{Date: page.Events[last].OperationDate, ID: ids[last]}
+		if page.NextCursor, err = encodeCursor(after); err != nil {
+			return models.SegmentHistoryPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// GetSegmentDailyHistory возвращает по каждому дню периода количество добавлений и удалений (истечение участия
+// считается удалением) и размер сегмента на конец дня. Дни считаются в часовом поясе периода. Размер считается
+// по всей истории сегмента до конца дня, поэтому не учитывает участников, добавленных до появления истории.
+func (db *DB) GetSegmentDailyHistory(ctx context.Context, slug string, period models.ReportPeriod) ([]models.SegmentDay, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := db.checkSegmentExists(ctx, slug); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.QueryContext(ctx,
+		`WITH events AS (
+             SELECT date_trunc('day', operation_date::TIMESTAMPTZ AT TIME ZONE $4) AS day,
+                    COUNT(*) FILTER (WHERE operation = 'add') AS joins,
+                    COUNT(*) FILTER (WHERE operation IN ('remove', 'expire')) AS leaves
+             FROM user_segment_history
+             WHERE segment_slug = $1 AND `+historyPeriod+`
+             GROUP BY 1
+         ), initial AS (
+             SELECT COUNT(*) FILTER (WHERE operation = 'add') - COUNT(*) FILTER (WHERE operation IN ('remove', 'expire')) AS size
+             FROM user_segment_history
+             WHERE segment_slug = $1 AND operation_date < $2::TIMESTAMPTZ::TIMESTAMP
+         )
+         SELECT to_char(d.day, 'YYYY-MM-DD'), COALESCE(e.joins, 0), COALESCE(e.leaves, 0),
+                (initial.size + SUM(COALESCE(e.joins, 0) - COALESCE(e.leaves, 0)) OVER (ORDER BY d.day))::BIGINT
+         FROM generate_series(date_trunc('day', $2::TIMESTAMPTZ AT TIME ZONE $4),
+                              ($3::TIMESTAMPTZ AT TIME ZONE $4) - INTERVAL '1 microsecond',
+                              INTERVAL '1 day') AS d(day)
+         LEFT JOIN events e ON e.day = d.day
+         CROSS JOIN initial
+         ORDER BY d.day`,
+		slug, period.From, period.To, period.Location.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily history of segment '%s': %w", slug, err)
+	}
+	defer rows.Close()
+
+	days := []models.SegmentDay{}
+	for rows.Next() {
+		var day models.SegmentDay
+		if err := rows.Scan(&day.Date, &day.Joins, &day.Leaves, &day.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan segment day: %w", err)
+		}
+		day.Net = day.Joins - day.Leaves
+		days = append(days, day)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return days, nil
+}
+
+// GetSegmentReport создает CSV отчет по всем событиям сегмента за период и возвращает ссылку на его скачивание.
+// Даты событий в отчете указываются в часовом поясе периода.
+func (db *DB) GetSegmentReport(ctx context.Context, slug string, period models.ReportPeriod) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := db.checkSegmentExists(ctx, slug); err != nil {
+		return "", err
+	}
+
+	fileName := segmentReportName(slug, period)
+	if _, err := db.writeReport(ctx, fileName, period.Location, nil, segmentReportEvents, slug, period.From, period.To); err != nil {
+		return "", err
+	}
+
+	return db.reports.Link(fileName), nil
+}
+
+// scanSegmentEvent читает событие сегмента, выбранное запросом segmentEvents, вместе с его ID
+func scanSegmentEvent(rows *sql.Rows) (int64, models.SegmentEvent, error) {
+	var id int64
+	var event models.SegmentEvent
+	if err := rows.Scan(&id, &event.UserID, &event.Operation, &event.OperationDate, &event.Variant); err != nil {
+		return 0, models.SegmentEvent{}, fmt.Errorf("failed to scan segment event: %w", err)
+	}
+
+	return id, event, nil
+}
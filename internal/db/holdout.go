@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"user-segmentation-service/internal/models"
+)
+
+// ErrHoldout возвращается при попытке добавить в сегмент пользователя из holdout
+var ErrHoldout = errors.New("user is in holdout")
+
+// SetHoldout задает процент holdout для группы исключения (пустая группа – глобальный holdout);
+// процент 0 отключает holdout. Пользователи, попавшие в holdout, удаляются из сегментов, на которые он распространяется.
+// Возвращает количество удаленных записей.
+func (db *DB) SetHoldout(ctx context.Context, exclusionGroup string, percentage float64) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if percentage < 0 || percentage > 100 {
+		return 0, newError(ErrValidation, "holdout percentage should be between 0 and 100")
+	}
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	if percentage == 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM holdouts WHERE exclusion_group = $1", exclusionGroup)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO holdouts(exclusion_group, percentage) VALUES($1, $2)
+             ON CONFLICT (exclusion_group) DO UPDATE SET percentage = EXCLUDED.percentage`,
+			exclusionGroup, percentage,
+		)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to set holdout '%s': %w", exclusionGroup, err)
+	}
+
+	// Удаление пользователей holdout из сегментов; пользователи, вышедшие из holdout, в сегменты не возвращаются
+	removed, err := deleteUserSegments(ctx, tx,
+		`SELECT user_id, segment_slug FROM user_segments WHERE in_holdout($1, exclusion_group, user_id)`,
+		db.salt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove holdout users from segments: %w", err)
+	}
+
+	// Завершение транзакции
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return removed, nil
+}
+
+// GetHoldouts возвращает настроенные holdout
+func (db *DB) GetHoldouts(ctx context.Context) ([]models.Holdout, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, "SELECT exclusion_group, percentage FROM holdouts ORDER BY exclusion_group")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holdouts: %w", err)
+	}
+	defer rows.Close()
+
+	holdouts := []models.Holdout{}
+	for rows.Next() {
+		var holdout models.Holdout
+		if err := rows.Scan(&holdout.ExclusionGroup, &holdout.Percentage); err != nil {
+			return nil, fmt.Errorf("failed to scan holdout: %w", err)
+		}
+		holdouts = append(holdouts, holdout)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return holdouts, nil
+}
+
+// GetUserHoldouts возвращает группы исключения, в holdout которых входит пользователь, по возрастанию
+// (пустая строка – глобальный holdout, она всегда первая)
+func (db *DB) GetUserHoldouts(ctx context.Context, userID int) ([]string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT exclusion_group FROM holdouts
+         WHERE segment_bucket($1, 'holdout:' || exclusion_group, $2) < percentage
+         ORDER BY exclusion_group`,
+		db.salt, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holdouts of user with ID '%d': %w", userID, err)
+	}
+	defer rows.Close()
+
+	groups := []string{}
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, fmt.Errorf("failed to scan holdout: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return groups, nil
+}
+
+// checkHoldout проверяет, что пользователь не входит в holdout, распространяющийся на сегмент
+func (db *DB) checkHoldout(ctx context.Context, tx *sql.Tx, userID int, slug string, exclusionGroup sql.NullString) error {
+	var inHoldout bool
+	if err := tx.QueryRowContext(ctx, "SELECT in_holdout($1, $2, $3)", db.salt, exclusionGroup, userID).Scan(&inHoldout); err != nil {
+		return fmt.Errorf("failed to check holdout of user with ID '%d': %w", userID, err)
+	}
+
+	if inHoldout {
+		return newError(ErrConflict, "%w: user with ID '%d' cannot be added to segment '%s'", ErrHoldout, userID, slug)
+	}
+
+	return nil
+}
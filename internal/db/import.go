@@ -0,0 +1,301 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+)
+
+// maxImportRejections ограничивает количество отклоненных строк в ответе; остальные только подсчитываются
+const maxImportRejections = 100
+
+// Состояния строк импорта после проверки; строки без состояния добавляются в сегмент
+const (
+	importDuplicate = "duplicate" // пользователь уже встречался в файле выше
+	importMember    = "member"    // пользователь уже состоит в сегменте
+	importUnknown   = "unknown"   // пользователь не существует
+	importHoldout   = "holdout"   // пользователь входит в holdout
+	importExclusion = "exclusion" // пользователь состоит в другом сегменте группы исключения
+)
+
+// importRejections сообщения об отклоненных строках по их состояниям
+var importRejections = map[string]string{
+	importUnknown:   "user does not exist",
+	importHoldout:   "user is in holdout",
+	importExclusion: "user is already in another segment of the exclusion group",
+}
+
+// ImportSegmentUsers добавляет в сегмент пользователей из CSV со столбцами user_id и необязательным expiration_date
+// (RFC 3339 или YYYY-MM-DD; без даты используется срок сегмента). Первая строка, в которой user_id не является числом,
+// считается заголовком. В режиме replace участники, которых нет в файле, удаляются из сегмента.
+//
+// Файл читается потоком и загружается в базу данных через COPY, проверки выполняются запросами над всеми строками.
+// Импорт выполняется одной транзакцией: при ошибке сегмент не меняется. Время импорта включает загрузку файла,
+// поэтому он ограничен только отменой ctx, а не PG_QUERY_TIMEOUT.
+func (db *DB) ImportSegmentUsers(ctx context.Context, slug string, replace bool, r io.Reader) (models.ImportResult, error) {
+	result := models.ImportResult{Rejections: []models.ImportRejection{}}
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	// Блокировка сегмента, чтобы параллельные импорты в режиме replace не удаляли участников друг друга
+	var segmentRule, exclusionGroup sql.NullString
+	err = tx.QueryRowContext(ctx,
+		"SELECT rule, exclusion_group FROM segments WHERE slug = $1 FOR UPDATE",
+		slug,
+	).Scan(&segmentRule, &exclusionGroup)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+	} else if err != nil {
+		return result, fmt.Errorf("failed to query existing segment: %w", err)
+	}
+	if segmentRule.Valid {
+		return result, newError(ErrConflict, "segment with slug '%s' is rule-based and cannot be assigned manually", slug)
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`CREATE TEMP TABLE segment_import (line INTEGER, user_id INTEGER, expiration_date TIMESTAMP, status TEXT)
+         ON COMMIT DROP`,
+	); err != nil {
+		return result, fmt.Errorf("failed to create import table: %w", err)
+	}
+
+	if err = copyImportRows(ctx, tx, r, &result); err != nil {
+		return result, err
+	}
+
+	// Временные таблицы не анализируются автоматически, без статистики проверки больших файлов выполняются медленно
+	if _, err = tx.ExecContext(ctx, "CREATE INDEX ON segment_import (user_id, line)"); err != nil {
+		return result, fmt.Errorf("failed to index import table: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "ANALYZE segment_import"); err != nil {
+		return result, fmt.Errorf("failed to analyze import table: %w", err)
+	}
+
+	// Проверки выполняются по порядку: строка получает первое подходящее состояние
+	checks := []struct {
+		status    string
+		condition string
+		args      []interface{}
+	}{
+		{importDuplicate, `EXISTS (SELECT 1 FROM segment_import prev WHERE prev.user_id = i.user_id AND prev.line < i.line)`, nil},
+		{importUnknown, `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = i.user_id)`, nil},
+		{importMember, `EXISTS (SELECT 1 FROM user_segments us WHERE us.user_id = i.user_id AND us.segment_slug = $1)`, []interface{}{slug}},
+		{importHoldout, `in_holdout($1, $2, i.user_id)`, []interface{}{db.salt, exclusionGroup}},
+		{importExclusion, `EXISTS (SELECT 1 FROM user_segments us
+                                   WHERE us.user_id = i.user_id AND us.exclusion_group = $1 AND us.segment_slug <> $2)`,
+			[]interface{}{exclusionGroup, slug}},
+	}
+	for _, check := range checks {
+		if _, err = tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE segment_import i SET status = '%s' WHERE i.status IS NULL AND %s", check.status, check.condition),
+			check.args...,
+		); err != nil {
+			return result, fmt.Errorf("failed to check imported users (%s): %w", check.status, err)
+		}
+	}
+
+	// В режиме replace из сегмента удаляются участники, которых нет в файле
+	if replace {
+		if result.Removed, err = deleteUserSegments(ctx, tx,
+			`SELECT us.user_id, us.segment_slug FROM user_segments us
+             WHERE us.segment_slug = $1 AND NOT EXISTS (SELECT 1 FROM segment_import i WHERE i.user_id = us.user_id)`,
+			slug,
+		); err != nil {
+			return result, err
+		}
+	}
+
+	if result.Added, err = db.insertUserSegments(ctx, tx,
+		`SELECT i.user_id, s.slug, COALESCE(i.expiration_date, s.expiration_date)
+         FROM segment_import i JOIN segments s ON s.slug = $1
+         WHERE i.status IS NULL`,
+		slug,
+	); err != nil {
+		return result, err
+	}
+
+	if err = countImportRows(ctx, tx, &result); err != nil {
+		return result, err
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// copyImportRows читает строки CSV и загружает корректные строки в segment_import через COPY.
+// Строки с некорректным форматом отклоняются сразу.
+func copyImportRows(ctx context.Context, tx *sql.Tx, r io.Reader, result *models.ImportResult) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("segment_import", "line", "user_id", "expiration_date"))
+	if err != nil {
+		return fmt.Errorf("failed to start import: %w", err)
+	}
+	defer stmt.Close()
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	now := time.Now()
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return fmt.Errorf("failed to read import file: %w", err)
+			}
+			result.Rows++
+			reject(result, models.ImportRejection{Line: parseErr.Line, Error: "invalid CSV: " + parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		userID, expirationDate, err := parseImportRecord(record, now)
+		// Первая строка без числового user_id – заголовок файла
+		if line == 1 && errors.Is(err, errInvalidUserID) {
+			continue
+		}
+		result.Rows++
+		if err != nil {
+			reject(result, models.ImportRejection{Line: line, Error: err.Error()})
+			continue
+		}
+
+		if _, err = stmt.ExecContext(ctx, line, userID, nullTime(expirationDate)); err != nil {
+			return fmt.Errorf("failed to import line %d: %w", line, err)
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to finish import: %w", err)
+	}
+
+	return nil
+}
+
+// errInvalidUserID строка импорта без числового user_id
+var errInvalidUserID = errors.New("user ID should be an integer")
+
+// parseImportRecord разбирает строку импорта: user_id и необязательную дату истечения участия в будущем
+func parseImportRecord(record []string, now time.Time) (int, time.Time, error) {
+	userID, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return 0, time.Time{}, errInvalidUserID
+	}
+	// Идентификаторы пользователей – положительные INTEGER; остальные значения не могут быть записаны в таблицу импорта
+	if userID < 1 || userID > math.MaxInt32 {
+		return userID, time.Time{}, fmt.Errorf("user ID should be between 1 and %d", math.MaxInt32)
+	}
+
+	var expirationDate time.Time
+	if len(record) > 1 {
+		if value := strings.TrimSpace(record[1]); value != "" {
+			if expirationDate, err = time.Parse(time.RFC3339, value); err != nil {
+				if expirationDate, err = time.Parse(time.DateOnly, value); err != nil {
+					return userID, time.Time{}, errors.New("expiration date should be in format RFC 3339 or YYYY-MM-DD")
+				}
+			}
+			if !expirationDate.After(now) {
+				return userID, time.Time{}, errors.New("expiration date should be in the future")
+			}
+		}
+	}
+
+	return userID, expirationDate, nil
+}
+
+// countImportRows подсчитывает пропущенные и отклоненные при проверке строки и добавляет в результат первые отклоненные строки
+func countImportRows(ctx context.Context, tx *sql.Tx, result *models.ImportResult) error {
+	rows, err := tx.QueryContext(ctx, "SELECT status, COUNT(*) FROM segment_import WHERE status IS NOT NULL GROUP BY status")
+	if err != nil {
+		return fmt.Errorf("failed to count imported users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return fmt.Errorf("failed to scan imported users count: %w", err)
+		}
+		if _, rejected := importRejections[status]; rejected {
+			result.Rejected += count
+		} else {
+			result.Duplicates += count
+		}
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx,
+		"SELECT line, user_id, status FROM segment_import WHERE status IN ($1, $2, $3) ORDER BY line LIMIT $4",
+		importUnknown, importHoldout, importExclusion, maxImportRejections,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query rejected users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rejection models.ImportRejection
+		var status string
+		if err := rows.Scan(&rejection.Line, &rejection.UserID, &status); err != nil {
+			return fmt.Errorf("failed to scan rejected user: %w", err)
+		}
+		rejection.Error = importRejections[status]
+		result.Rejections = append(result.Rejections, rejection)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	// Строки с некорректным форматом и отклоненные при проверке объединяются в порядке файла
+	slices.SortFunc(result.Rejections, func(a, b models.ImportRejection) int { return cmp.Compare(a.Line, b.Line) })
+	if len(result.Rejections) > maxImportRejections {
+		result.Rejections = result.Rejections[:maxImportRejections]
+	}
+
+	return nil
+}
+
+// reject учитывает отклоненную строку; в результат попадают первые maxImportRejections строк
+func reject(result *models.ImportResult, rejection models.ImportRejection) {
+	result.Rejected++
+	if len(result.Rejections) < maxImportRejections {
+		result.Rejections = append(result.Rejections, rejection)
+	}
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+)
+
+// insertUserSegments добавляет пользователей в сегменты и записывает добавления в историю.
+// source – запрос, возвращающий строки (user_id, segment_slug, expiration_date);
+// уже существующие записи, пользователи holdout и записи, для которых пользователь уже состоит в другом сегменте
+// той же группы исключения, пропускаются. Пользователю назначается вариант сегмента, если они заданы.
+// Возвращает количество добавленных записей.
+func (db *DB) insertUserSegments(ctx context.Context, tx *sql.Tx, source string, args ...interface{}) (int, error) {
+	// Соль передается последним параметром, после параметров source
+	saltParam := fmt.Sprintf("$%d", len(args)+1)
+
+	res, err := tx.ExecContext(ctx,
+		`WITH added AS (
+             INSERT INTO user_segments(user_id, segment_slug, expiration_date, exclusion_group, variant)
+             SELECT src.user_id, src.segment_slug, src.expiration_date, s.exclusion_group,
+                    segment_variant(`+saltParam+`, s.slug, src.user_id)
+             FROM (`+source+`) AS src(user_id, segment_slug, expiration_date)
+             JOIN segments s ON s.slug = src.segment_slug
+             WHERE NOT in_holdout(`+saltParam+`, s.exclusion_group, src.user_id)
+             ON CONFLICT DO NOTHING
+             RETURNING user_id, segment_slug, variant
+         )
+         INSERT INTO user_segment_history(user_id, segment_slug, operation, variant)
+         SELECT user_id, segment_slug, 'add', variant FROM added`,
+		append(args, db.salt)...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert user segments: %w", err)
+	}
+
+	added, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of inserted user segments: %w", err)
+	}
+
+	return int(added), nil
+}
+
+// deleteUserSegments удаляет пользователей из сегментов и записывает удаления в историю.
+// source – запрос, возвращающий строки (user_id, segment_slug). Возвращает количество удаленных записей.
+func deleteUserSegments(ctx context.Context, tx *sql.Tx, source string, args ...interface{}) (int, error) {
+	res, err := tx.ExecContext(ctx,
+		`WITH removed AS (
+             DELETE FROM user_segments us
+             USING (`+source+`) AS src(user_id, segment_slug)
+             WHERE us.user_id = src.user_id AND us.segment_slug = src.segment_slug
+             RETURNING us.user_id, us.segment_slug, us.variant
+         )
+         INSERT INTO user_segment_history(user_id, segment_slug, operation, variant)
+         SELECT user_id, segment_slug, 'remove', variant FROM removed`,
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user segments: %w", err)
+	}
+
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of deleted user segments: %w", err)
+	}
+
+	return int(removed), nil
+}
+
+// enrollUsers добавляет пользователей во все активные процентные сегменты.
+// Для сегментов с bucketing = 'hash' решение детерминировано корзиной пользователя,
+// для остальных пользователь попадает в сегмент с вероятностью random_percentage.
+func (db *DB) enrollUsers(ctx context.Context, tx *sql.Tx, userIDs []int64) error {
+	_, err := db.insertUserSegments(ctx, tx,
+		`SELECT u.id, s.slug, s.expiration_date
+         FROM unnest($1::int[]) AS u(id)
+         JOIN segments s ON s.random_percentage > 0 AND (s.expiration_date IS NULL OR s.expiration_date > NOW())
+         WHERE CASE WHEN s.bucketing = 'hash' THEN segment_bucket($2, s.slug, u.id) < s.random_percentage
+                    ELSE random() * 100 < s.random_percentage END`,
+		pq.Array(userIDs), db.salt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enroll users into percentage segments: %w", err)
+	}
+
+	return nil
+}
+
+// setSegmentPercentage меняет процент пользователей сегмента с from на to, добавляя или удаляя только разницу.
+// Для bucketing = 'hash' затрагиваются пользователи с корзиной в диапазоне между from и to, поэтому
+// остальные участники сегмента не меняются. Для bucketing = 'random' добавляется (удаляется) столько
+// случайных пользователей, не состоящих (состоящих) в сегменте, сколько недостает (лишних) до доли to
+// от всех пользователей с учетом текущего числа участников.
+func (db *DB) setSegmentPercentage(ctx context.Context, tx *sql.Tx, slug, bucketing string, from, to float64) (models.MembershipChanges, error) {
+	var changes models.MembershipChanges
+	var err error
+
+	if _, err = tx.ExecContext(ctx, "UPDATE segments SET random_percentage = $2 WHERE slug = $1", slug, to); err != nil {
+		return changes, fmt.Errorf("failed to update percentage of segment '%s': %w", slug, err)
+	}
+
+	if bucketing == models.BucketingHash {
+		if to > from {
+			changes.Added, err = db.insertUserSegments(ctx, tx,
+				`SELECT u.id, s.slug, s.expiration_date FROM users u JOIN segments s ON s.slug = $1
+                 WHERE segment_bucket($2, s.slug, u.id) >= $3 AND segment_bucket($2, s.slug, u.id) < $4`,
+				slug, db.salt, from, to,
+			)
+		} else if to < from {
+			changes.Removed, err = deleteUserSegments(ctx, tx,
+				`SELECT user_id, segment_slug FROM user_segments
+                 WHERE segment_slug = $1
+                   AND segment_bucket($2, segment_slug, user_id) >= $3 AND segment_bucket($2, segment_slug, user_id) < $4`,
+				slug, db.salt, to, from,
+			)
+		}
+	} else {
+		// Получение общего числа пользователей
+		var totalUsers int
+		if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&totalUsers); err != nil {
+			return changes, fmt.Errorf("failed to count total users: %w", err)
+		}
+
+		// Получение текущего числа участников сегмента: оно может отличаться от доли from, если пользователи
+		// добавлялись и удалялись вручную, по правилу или по истечении срока
+		var members int
+		if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_segments WHERE segment_slug = $1", slug).Scan(&members); err != nil {
+			return changes, fmt.Errorf("failed to count users of segment '%s': %w", slug, err)
+		}
+
+		// Вычисление числа пользователей, на которое меняется сегмент, чтобы в нем осталась доля to
+		delta := int(float64(totalUsers)*(to/100.0)) - members
+
+		if delta > 0 {
+			changes.Added, err = db.insertUserSegments(ctx, tx,
+				`SELECT u.id, s.slug, s.expiration_date FROM users u JOIN segments s ON s.slug = $1
+                 WHERE NOT EXISTS (SELECT 1 FROM user_segments us WHERE us.user_id = u.id
+                                   AND (us.segment_slug = s.slug OR us.exclusion_group = s.exclusion_group))
+                   AND NOT in_holdout($3, s.exclusion_group, u.id)
+                 ORDER BY RANDOM() LIMIT $2`,
+				slug, delta, db.salt,
+			)
+		} else if delta < 0 {
+			changes.Removed, err = deleteUserSegments(ctx, tx,
+				`SELECT user_id, segment_slug FROM user_segments WHERE segment_slug = $1 ORDER BY RANDOM() LIMIT $2`,
+				slug, -delta,
+			)
+		}
+	}
+	if err != nil {
+		return changes, fmt.Errorf("failed to change percentage of segment '%s': %w", slug, err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"user-segmentation-service/internal/models"
+)
+
+// Запросы событий отчетов по пользователю ($1 – ID пользователя) и по сегменту ($1 – slug) за период [$2, $3).
+// Возвращают строки (user_id, segment_slug, operation, operation_date, variant) в порядке даты.
+const (
+	userReportEvents = `SELECT user_id, segment_slug, operation, operation_date::TIMESTAMPTZ, COALESCE(variant, '')
+         FROM user_segment_history
+         WHERE user_id = $1 AND ` + historyPeriod + `
+         ORDER BY operation_date, id`
+	segmentReportEvents = `SELECT user_id, segment_slug, operation, operation_date::TIMESTAMPTZ, COALESCE(variant, '')
+         FROM user_segment_history
+         WHERE segment_slug = $1 AND ` + historyPeriod + `
+         ORDER BY operation_date, id`
+)
+
+// reportProgressRows количество строк отчета, после записи которых сохраняется прогресс задания
+const reportProgressRows = 10000
+
+// maxReportAttempts количество запусков задания, после которого прерванное задание не возвращается в очередь
+const maxReportAttempts = 3
+
+// errLeaseLost задание больше не выполняется этим запуском: аренда истекла, и задание возвращено в очередь
+var errLeaseLost = errors.New("report job lease is lost")
+
+// reportJobColumns столбцы задания на создание отчета
+const reportJobColumns = `id, type, COALESCE(user_id, 0), COALESCE(segment_slug, ''), period_from, period_to, time_zone,
+       status, rows_total, rows_written, attempts, COALESCE(file_name, ''), COALESCE(error, ''), created_at, started_at, finished_at`
+
+// CreateReportJob проверяет, что пользователь или сегмент отчета существует, и ставит задание на создание отчета в очередь
+func (db *DB) CreateReportJob(ctx context.Context, job models.ReportJob) (models.ReportJob, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var err error
+	switch job.Type {
+	case models.ReportUser:
+		err = db.checkUserExists(ctx, job.UserID)
+	case models.ReportSegment:
+		err = db.checkSegmentExists(ctx, job.SegmentSlug)
+	default:
+		err = newError(ErrValidation, "unknown report type '%s'", job.Type)
+	}
+	if err != nil {
+		return models.ReportJob{}, err
+	}
+
+	row := db.db.QueryRowContext(ctx,
+		`INSERT INTO report_jobs(type, user_id, segment_slug, period_from, period_to, time_zone)
+         VALUES($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5, $6)
+         RETURNING `+reportJobColumns,
+		job.Type, job.UserID, job.SegmentSlug, job.From, job.To, job.TimeZone,
+	)
+	if job, err = scanReportJob(row); err != nil {
+		return models.ReportJob{}, fmt.Errorf("failed to insert report job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetReportJob возвращает задание на создание отчета и его состояние; для выполненного задания – ссылку на файл отчета
+func (db *DB) GetReportJob(ctx context.Context, jobID int) (models.ReportJob, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	job, err := scanReportJob(db.db.QueryRowContext(ctx, "SELECT "+reportJobColumns+" FROM report_jobs WHERE id = $1", jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ReportJob{}, newError(ErrNotFound, "report job with ID '%d' does not exist", jobID)
+	} else if err != nil {
+		return models.ReportJob{}, fmt.Errorf("failed to query report job with ID '%d': %w", jobID, err)
+	}
+
+	if job.Status == models.ReportDone {
+		job.DownloadLink = db.reports.Link(job.FileName)
+	}
+
+	return job, nil
+}
+
+// ClaimReportJob забирает из очереди самое раннее задание, отмечает его выполняемым и берет в аренду на срок lease;
+// ok = false, если очередь пуста. Задания, выбранные другими обработчиками, пропускаются (SKIP LOCKED),
+// поэтому каждое задание выполняется одним обработчиком.
+func (db *DB) ClaimReportJob(ctx context.Context, lease time.Duration) (job models.ReportJob, ok bool, err error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	job, err = scanReportJob(db.db.QueryRowContext(ctx,
+		`UPDATE report_jobs
+         SET status = 'running', attempts = attempts + 1, started_at = NOW(), locked_until = NOW() + make_interval(secs => $1),
+             rows_total = 0, rows_written = 0
+         WHERE id = (SELECT id FROM report_jobs WHERE status = 'queued' ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+         RETURNING `+reportJobColumns,
+		lease.Seconds(),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ReportJob{}, false, nil
+	} else if err != nil {
+		return models.ReportJob{}, false, fmt.Errorf("failed to claim report job: %w", err)
+	}
+
+	return job, true, nil
+}
+
+// ExtendReportJobLease продлевает аренду выполняемого задания на срок lease. Возвращает false, если задание
+// больше не выполняется этим запуском: аренда истекла и задание возвращено в очередь или забрано другим обработчиком.
+func (db *DB) ExtendReportJobLease(ctx context.Context, job models.ReportJob, lease time.Duration) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.updateRunningJob(ctx, job, "locked_until = NOW() + make_interval(secs => $3)", lease.Seconds())
+	if errors.Is(err, errLeaseLost) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RunReportJob создает файл отчета задания, сохраняя прогресс, и отмечает задание выполненным или завершившимся ошибкой.
+// Создание отчета ограничено только отменой ctx. Задание, прерванное остановкой сервиса, остается выполняемым
+// и возвращается в очередь после истечения аренды (см. RequeueExpiredReportJobs). Задание изменяется, только пока
+// оно выполняется этим запуском, поэтому обработчик, потерявший аренду, не перезаписывает результат другого.
+func (db *DB) RunReportJob(ctx context.Context, job models.ReportJob) error {
+	err := db.runReportJob(ctx, job)
+	if err == nil || ctx.Err() != nil || errors.Is(err, errLeaseLost) {
+		return err
+	}
+
+	// Клиенту сообщаются только ошибки предметной области (например, удаленный сегмент), остальные записываются в лог
+	message := "failed to generate report"
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		message = domainErr.Error()
+	}
+
+	updateCtx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	if updateErr := db.updateRunningJob(updateCtx, job,
+		"status = 'failed', error = $3, finished_at = NOW(), locked_until = NULL", message,
+	); updateErr != nil {
+		log.Printf("Failed to mark report job %d as failed: %v\n", job.ID, updateErr)
+	}
+
+	return err
+}
+
+// runReportJob записывает файл отчета задания и отмечает задание выполненным
+func (db *DB) runReportJob(ctx context.Context, job models.ReportJob) error {
+	location, err := time.LoadLocation(job.TimeZone)
+	if err != nil {
+		return fmt.Errorf("failed to load time zone '%s': %w", job.TimeZone, err)
+	}
+	period := models.ReportPeriod{From: job.From, To: job.To, Location: location}
+
+	var query, name string
+	var subject interface{}
+	switch job.Type {
+	case models.ReportUser:
+		if err = db.checkUserExists(ctx, job.UserID); err != nil {
+			return err
+		}
+		query, subject = userReportEvents, job.UserID
+		name = fmt.Sprintf("user_%d_report_%s.csv", job.UserID, reportPeriodName(period))
+	case models.ReportSegment:
+		if err = db.checkSegmentExists(ctx, job.SegmentSlug); err != nil {
+			return err
+		}
+		query, subject = segmentReportEvents, job.SegmentSlug
+		name = segmentReportName(job.SegmentSlug, period)
+	default:
+		return newError(ErrValidation, "unknown report type '%s'", job.Type)
+	}
+
+	// Количество строк нужно только для прогресса, поэтому считается до записи отчета отдельным запросом
+	var total int
+	if err = db.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM ("+query+") AS events", subject, period.From, period.To,
+	).Scan(&total); err != nil {
+		return fmt.Errorf("failed to count rows of report job %d: %w", job.ID, err)
+	}
+	if err = db.updateRunningJob(ctx, job, "rows_total = $3", total); err != nil {
+		return err
+	}
+
+	// Имя файла содержит ID задания и номер запуска, чтобы одинаковые отчеты разных заданий и повторные запуски
+	// одного задания не перезаписывали друг друга
+	fileName := fmt.Sprintf("report_%d_%d_%s", job.ID, job.Attempts, name)
+	progress := func(rows int) error {
+		return db.updateRunningJob(ctx, job, "rows_written = $3", rows)
+	}
+	written, err := db.writeReport(ctx, fileName, location, progress, query, subject, period.From, period.To)
+	if err != nil {
+		return err
+	}
+
+	// История могла измениться после подсчета строк, поэтому итоговое количество берется по записанному файлу
+	return db.updateRunningJob(ctx, job,
+		"status = 'done', rows_total = $3, rows_written = $3, file_name = $4, finished_at = NOW(), locked_until = NULL",
+		written, fileName,
+	)
+}
+
+// updateRunningJob изменяет задание выражением set ($3 и далее – args), если задание выполняется запуском job.Attempts;
+// иначе возвращает errLeaseLost
+func (db *DB) updateRunningJob(ctx context.Context, job models.ReportJob, set string, args ...interface{}) error {
+	res, err := db.db.ExecContext(ctx,
+		"UPDATE report_jobs SET "+set+" WHERE id = $1 AND attempts = $2 AND status = 'running'",
+		append([]interface{}{job.ID, job.Attempts}, args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update report job %d: %w", job.ID, err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of updated report jobs: %w", err)
+	}
+	if updated == 0 {
+		return errLeaseLost
+	}
+
+	return nil
+}
+
+// RequeueExpiredReportJobs возвращает в очередь выполняемые задания с истекшей арендой: их обработчик остановлен
+// или потерял связь с базой данных. Задания, прерванные maxReportAttempts раз, отмечаются завершившимися ошибкой.
+// Задания с действующей арендой не затрагиваются, поэтому вызов безопасен при нескольких экземплярах сервиса.
+// Возвращает количество измененных заданий.
+func (db *DB) RequeueExpiredReportJobs(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.db.ExecContext(ctx,
+		`UPDATE report_jobs
+         SET status = CASE WHEN attempts < $1 THEN 'queued' ELSE 'failed' END,
+             error = CASE WHEN attempts < $1 THEN NULL ELSE 'report generation was interrupted too many times' END,
+             finished_at = CASE WHEN attempts < $1 THEN NULL ELSE NOW() END,
+             locked_until = NULL
+         WHERE status = 'running' AND (locked_until IS NULL OR locked_until < NOW())`,
+		maxReportAttempts,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue expired report jobs: %w", err)
+	}
+
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of requeued report jobs: %w", err)
+	}
+
+	return int(requeued), nil
+}
+
+// scanReportJob читает задание, выбранное по столбцам reportJobColumns, и вычисляет его прогресс
+func scanReportJob(row *sql.Row) (models.ReportJob, error) {
+	var job models.ReportJob
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Type, &job.UserID, &job.SegmentSlug, &job.From, &job.To, &job.TimeZone,
+		&job.Status, &job.RowsTotal, &job.RowsWritten, &job.Attempts, &job.FileName, &job.Error, &job.CreatedAt, &startedAt, &finishedAt); err != nil {
+		return models.ReportJob{}, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	switch {
+	case job.Status == models.ReportDone:
+		job.Progress = 100
+	case job.RowsTotal > 0:
+		job.Progress = min(job.RowsWritten*100/job.RowsTotal, 99)
+	}
+
+	return job, nil
+}
+
+// writeReport создает CSV отчет fileName по событиям, выбранным запросом query (см. userReportEvents),
+// с датами в часовом поясе location, и сохраняет его в хранилище отчетов. Отчет сначала записывается во временный
+// файл, поэтому в хранилище не попадает частично записанный отчет. progress, если задан, вызывается с количеством
+// записанных строк каждые reportProgressRows строк. Возвращает количество записанных строк.
+func (db *DB) writeReport(ctx context.Context, fileName string, location *time.Location, progress func(rows int) error,
+	query string, args ...interface{}) (int, error) {
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query report events: %w", err)
+	}
+	defer rows.Close()
+
+	file, err := os.CreateTemp("", "report_*.csv")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create CSV file '%s': %w", fileName, err)
+	}
+	defer func() {
+		if err := os.Remove(file.Name()); err != nil {
+			log.Printf("An error occurred while removing the temporary report file: %v\n", err)
+		}
+	}()
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"User ID", "Segment Slug", "Operation", "Operation Date", "Variant"}); err != nil {
+		return 0, fmt.Errorf("failed to write headers to CSV: %w", err)
+	}
+
+	// Запись данных в CSV файл
+	written := 0
+	for rows.Next() {
+		var userID int64
+		var slug, operation, variant string
+		var operationDate time.Time
+		if err := rows.Scan(&userID, &slug, &operation, &operationDate, &variant); err != nil {
+			return written, fmt.Errorf("failed to scan report event: %w", err)
+		}
+		record := []string{strconv.FormatInt(userID, 10), slug, operation, operationDate.In(location).Format(time.RFC3339), variant}
+		if err := w.Write(record); err != nil {
+			return written, fmt.Errorf("failed to write row to CSV file '%s': %w", fileName, err)
+		}
+
+		written++
+		if progress != nil && written%reportProgressRows == 0 {
+			if err := progress(written); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return written, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return written, fmt.Errorf("failed to write CSV file '%s': %w", fileName, err)
+	}
+
+	// Размер нужен хранилищу заранее: S3 принимает объект только с известной длиной
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return written, fmt.Errorf("failed to get size of CSV file '%s': %w", fileName, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return written, fmt.Errorf("failed to rewind CSV file '%s': %w", fileName, err)
+	}
+	if err := db.reports.Save(ctx, fileName, file, size); err != nil {
+		return written, err
+	}
+
+	return written, nil
+}
+
+// segmentReportName возвращает имя файла отчета по сегменту. Slug может содержать '/' и другие символы,
+// недопустимые в имени файла или ключе объекта, поэтому он экранируется как сегмент пути URL.
+func segmentReportName(slug string, period models.ReportPeriod) string {
+	return fmt.Sprintf("segment_%s_report_%s.csv", url.PathEscape(slug), reportPeriodName(period))
+}
+
+// reportPeriodName возвращает обозначение периода для имени файла отчета: месяц (2023-08), даты включительно
+// (2023-08-01_2023-08-31) или границы периода с точностью до секунды в часовом поясе периода
+func reportPeriodName(period models.ReportPeriod) string {
+	from, to := period.From.In(period.Location), period.To.In(period.Location)
+	midnight := func(t time.Time) bool {
+		return t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+	}
+
+	switch {
+	case midnight(from) && from.Day() == 1 && from.AddDate(0, 1, 0).Equal(to):
+		return from.Format("2006-01")
+	case midnight(from) && midnight(to):
+		return from.Format(time.DateOnly) + "_" + to.AddDate(0, 0, -1).Format(time.DateOnly)
+	default:
+		return from.Format("20060102T150405") + "_" + to.Format("20060102T150405")
+	}
+}
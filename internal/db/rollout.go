@@ -0,0 +1,382 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+)
+
+// rolloutTransitions допустимые переходы между статусами плана раскатки: целевой статус -> текущие статусы
+var rolloutTransitions = map[string][]string{
+	models.RolloutPaused:  {models.RolloutActive},
+	models.RolloutActive:  {models.RolloutPaused},
+	models.RolloutAborted: {models.RolloutActive, models.RolloutPaused},
+}
+
+// CreateRollout создает план постепенной раскатки сегмента. Шаги применяются фоновым планировщиком
+// по наступлении apply_at через setSegmentPercentage, поэтому текущие участники сегмента сохраняются.
+func (db *DB) CreateRollout(ctx context.Context, slug string, steps []models.RolloutStep) (models.Rollout, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	// Проверка наличия сегмента в базе данных
+	var existingId int
+	var segmentRule sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT id, rule FROM segments WHERE slug = $1 FOR UPDATE", slug).Scan(&existingId, &segmentRule)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rollout{}, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+	} else if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to query existing segment: %w", err)
+	}
+	if segmentRule.Valid {
+		return models.Rollout{}, newError(ErrConflict, "segment with slug '%s' is rule-based and has no percentage", slug)
+	}
+
+	// Проверка отсутствия незавершенного плана раскатки
+	var rolloutID int
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM segment_rollouts WHERE segment_slug = $1 AND status IN ('active', 'paused')",
+		slug,
+	).Scan(&rolloutID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return models.Rollout{}, fmt.Errorf("failed to query existing rollout: %w", err)
+		}
+
+		return models.Rollout{}, newError(ErrConflict, "segment with slug '%s' already has a rollout in progress", slug)
+	}
+
+	// Вставка плана и его шагов
+	err = tx.QueryRowContext(ctx, "INSERT INTO segment_rollouts(segment_slug) VALUES($1) RETURNING id", slug).Scan(&rolloutID)
+	if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to insert rollout: %w", err)
+	}
+
+	for _, step := range steps {
+		if _, err = tx.ExecContext(ctx,
+			"INSERT INTO segment_rollout_steps(rollout_id, percentage, apply_at) VALUES($1, $2, $3)",
+			rolloutID,
+			step.Percentage,
+			step.ApplyAt,
+		); err != nil {
+			return models.Rollout{}, fmt.Errorf("failed to insert rollout step: %w", err)
+		}
+	}
+
+	rollout, err := getRollout(ctx, tx, slug)
+	if err != nil {
+		return models.Rollout{}, err
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rollout, nil
+}
+
+// GetRollout возвращает последний план раскатки сегмента вместе с шагами
+func (db *DB) GetRollout(ctx context.Context, slug string) (models.Rollout, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	rollout, err := getRollout(ctx, tx, slug)
+	if err != nil {
+		return models.Rollout{}, err
+	}
+
+	// Завершение транзакции
+	if err = tx.Commit(); err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rollout, nil
+}
+
+// SetRolloutStatus приостанавливает, возобновляет или прерывает текущий план раскатки сегмента.
+// При возобновлении шаги, срок которых наступил во время паузы, применяются планировщиком сразу.
+func (db *DB) SetRolloutStatus(ctx context.Context, slug, status string) (models.Rollout, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	allowed, ok := rolloutTransitions[status]
+	if !ok {
+		return models.Rollout{}, newError(ErrValidation, "unknown rollout status '%s'", status)
+	}
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	// Блокировка последнего плана, чтобы планировщик не применил шаг одновременно со сменой статуса
+	var rolloutID int
+	var currentStatus string
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, status FROM segment_rollouts WHERE segment_slug = $1 ORDER BY id DESC LIMIT 1 FOR UPDATE",
+		slug,
+	).Scan(&rolloutID, &currentStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rollout{}, newError(ErrNotFound, "segment with slug '%s' has no rollout", slug)
+	} else if err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to query rollout: %w", err)
+	}
+
+	if !slices.Contains(allowed, currentStatus) {
+		return models.Rollout{}, newError(ErrConflict, "rollout of segment '%s' is %s and cannot become %s", slug, currentStatus, status)
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		"UPDATE segment_rollouts SET status = $2, updated_at = NOW() WHERE id = $1",
+		rolloutID,
+		status,
+	); err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to update rollout status: %w", err)
+	}
+
+	rollout, err := getRollout(ctx, tx, slug)
+	if err != nil {
+		return models.Rollout{}, err
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return models.Rollout{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rollout, nil
+}
+
+// ListDueRollouts возвращает ID активных планов раскатки, у которых есть наступившие непримененные шаги
+func (db *DB) ListDueRollouts(ctx context.Context) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx,
+		`SELECT DISTINCT r.id FROM segment_rollouts r
+         JOIN segment_rollout_steps st ON st.rollout_id = r.id
+         WHERE r.status = 'active' AND st.applied_at IS NULL AND st.apply_at <= NOW()`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due rollouts: %w", err)
+	}
+	defer rows.Close()
+
+	var rolloutIDs []int
+	for rows.Next() {
+		var rolloutID int
+		if err := rows.Scan(&rolloutID); err != nil {
+			return nil, fmt.Errorf("failed to scan rollout ID: %w", err)
+		}
+		rolloutIDs = append(rolloutIDs, rolloutID)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return rolloutIDs, nil
+}
+
+// ApplyRolloutSteps применяет наступившие шаги плана раскатки в отдельной транзакции со своим ограничением времени,
+// поэтому долгая раскатка одного сегмента не расходует время остальных.
+// Возвращает false, если план уже обрабатывается другим экземпляром сервиса или перестал быть активным.
+func (db *DB) ApplyRolloutSteps(ctx context.Context, rolloutID int) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.applyRolloutSteps(ctx, rolloutID)
+}
+
+// applyRolloutSteps переводит сегмент на процент последнего наступившего шага плана.
+// Более ранние наступившие шаги отмечаются примененными без изменений участников.
+// Возвращает false, если план уже обрабатывается другим экземпляром сервиса или перестал быть активным.
+func (db *DB) applyRolloutSteps(ctx context.Context, rolloutID int) (bool, error) {
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	// Блокировка плана и сегмента
+	var slug, bucketing string
+	var randomPercentage float64
+	err = tx.QueryRowContext(ctx,
+		`SELECT r.segment_slug, s.bucketing, s.random_percentage
+         FROM segment_rollouts r JOIN segments s ON s.slug = r.segment_slug
+         WHERE r.id = $1 AND r.status = 'active'
+         FOR UPDATE SKIP LOCKED`,
+		rolloutID,
+	).Scan(&slug, &bucketing, &randomPercentage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to query rollout %d: %w", rolloutID, err)
+	}
+
+	// Выборка наступивших шагов, начиная с последнего
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, percentage FROM segment_rollout_steps
+         WHERE rollout_id = $1 AND applied_at IS NULL AND apply_at <= NOW()
+         ORDER BY apply_at DESC, id DESC`,
+		rolloutID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to query due steps of rollout %d: %w", rolloutID, err)
+	}
+
+	var stepIDs []int
+	var percentage float64
+	for rows.Next() {
+		var stepID int
+		var stepPercentage float64
+		if err := rows.Scan(&stepID, &stepPercentage); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan rollout step: %w", err)
+		}
+		if len(stepIDs) == 0 {
+			percentage = stepPercentage
+		}
+		stepIDs = append(stepIDs, stepID)
+	}
+	rows.Close()
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+	if len(stepIDs) == 0 {
+		return false, nil
+	}
+
+	changes, err := db.setSegmentPercentage(ctx, tx, slug, bucketing, randomPercentage, percentage)
+	if err != nil {
+		return false, err
+	}
+
+	// Отметка шагов примененными; изменения участников записываются в последний шаг
+	if _, err = tx.ExecContext(ctx,
+		`UPDATE segment_rollout_steps
+         SET applied_at = NOW(),
+             added = CASE WHEN id = $2 THEN $3 ELSE 0 END,
+             removed = CASE WHEN id = $2 THEN $4 ELSE 0 END
+         WHERE id = ANY($1)`,
+		pq.Array(stepIDs),
+		stepIDs[0],
+		changes.Added,
+		changes.Removed,
+	); err != nil {
+		return false, fmt.Errorf("failed to mark rollout steps as applied: %w", err)
+	}
+
+	// Завершение плана, если шагов не осталось
+	if _, err = tx.ExecContext(ctx,
+		`UPDATE segment_rollouts
+         SET updated_at = NOW(),
+             status = CASE WHEN EXISTS (
+                 SELECT 1 FROM segment_rollout_steps WHERE rollout_id = $1 AND applied_at IS NULL
+             ) THEN status ELSE 'completed' END
+         WHERE id = $1`,
+		rolloutID,
+	); err != nil {
+		return false, fmt.Errorf("failed to update rollout %d: %w", rolloutID, err)
+	}
+
+	// Подтверждение транзакции
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Rollout of segment '%s' moved to %.2f%%: added %d, removed %d\n",
+		slug, percentage, changes.Added, changes.Removed)
+
+	return true, nil
+}
+
+// getRollout возвращает последний план раскатки сегмента в рамках транзакции
+func getRollout(ctx context.Context, tx *sql.Tx, slug string) (models.Rollout, error) {
+	var rollout models.Rollout
+	err := tx.QueryRowContext(ctx,
+		`SELECT r.id, r.segment_slug, r.status, s.random_percentage, r.created_at, r.updated_at
+         FROM segment_rollouts r JOIN segments s ON s.slug = r.segment_slug
+         WHERE r.segment_slug = $1
+         ORDER BY r.id DESC LIMIT 1`,
+		slug,
+	).Scan(&rollout.ID, &rollout.SegmentSlug, &rollout.Status, &rollout.CurrentPercentage, &rollout.CreatedAt, &rollout.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rollout, newError(ErrNotFound, "segment with slug '%s' has no rollout", slug)
+	} else if err != nil {
+		return rollout, fmt.Errorf("failed to query rollout: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT percentage, apply_at, applied_at, added, removed FROM segment_rollout_steps
+         WHERE rollout_id = $1 ORDER BY apply_at, id`,
+		rollout.ID,
+	)
+	if err != nil {
+		return rollout, fmt.Errorf("failed to query rollout steps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step models.RolloutStep
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&step.Percentage, &step.ApplyAt, &appliedAt, &step.Added, &step.Removed); err != nil {
+			return rollout, fmt.Errorf("failed to scan rollout step: %w", err)
+		}
+		if appliedAt.Valid {
+			step.AppliedAt = &appliedAt.Time
+		}
+		rollout.Steps = append(rollout.Steps, step)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return rollout, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return rollout, nil
+}
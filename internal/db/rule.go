@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/internal/rule"
+)
+
+// GetAttributeSchema возвращает объявленные атрибуты пользователей и их типы
+func (db *DB) GetAttributeSchema(ctx context.Context) (rule.Schema, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// Начало транзакции
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("An error occurred while rolling back the transaction: %v\n", err)
+		}
+	}()
+
+	schema, err := loadAttributeSchema(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Завершение транзакции
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return schema, nil
+}
+
+// SetAttributeType объявляет атрибут пользователей. Тип уже объявленного атрибута изменить нельзя,
+// так как от него зависят сохраненные правила и атрибуты пользователей.
+func (db *DB) SetAttributeType(ctx context.Context, name string, attributeType rule.Type) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var existingType string
+	err := db.db.QueryRowContext(ctx,
+		`INSERT INTO attribute_schema(name, type) VALUES($1, $2)
+         ON CONFLICT (name) DO UPDATE SET type = attribute_schema.type
+         RETURNING type`,
+		name,
+		string(attributeType),
+	).Scan(&existingType)
+	if err != nil {
+		return fmt.Errorf("failed to declare attribute '%s': %w", name, err)
+	}
+
+	if rule.Type(existingType) != attributeType {
+		return newError(ErrConflict, "attribute '%s' is already declared as %s", name, existingType)
+	}
+
+	return nil
+}
+
+// GetUserAttributes возвращает атрибуты пользователя
+func (db *DB) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var raw []byte
+	err := db.db.QueryRowContext(ctx, "SELECT attributes FROM users WHERE id = $1", userID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newError(ErrNotFound, "user with ID '%d' does not exist", userID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query attributes of user with ID '%d': %w", userID, err)
+	}
+
+	var attributes map[string]interface{}
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return nil, fmt.Errorf("failed to decode attributes of user with ID '%d': %w", userID, err)
+	}
+
+	return attributes, nil
+}
+
+// SampleUserAttributes возвращает атрибуты случайной выборки не более чем из limit пользователей
+func (db *DB) SampleUserAttributes(ctx context.Context, limit int) ([]models.UserAttributes, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, "SELECT id, attributes FROM users ORDER BY RANDOM() LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users sample: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.UserAttributes
+	for rows.Next() {
+		userID, attributes, err := scanUserAttributes(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, models.UserAttributes{UserId: int(userID), Attributes: attributes})
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// ruleSegment сегмент, участники которого определяются правилом над атрибутами пользователей
+type ruleSegment struct {
+	slug string
+	expr rule.Expr
+}
+
+// setSegmentRule заменяет правило сегмента и пересчитывает его участников.
+// Пустое правило превращает сегмент в обычный, текущие участники при этом сохраняются.
+func (db *DB) setSegmentRule(ctx context.Context, tx *sql.Tx, slug, ruleText string) (models.MembershipChanges, error) {
+	if ruleText == "" {
+		if _, err := tx.ExecContext(ctx, "UPDATE segments SET rule = NULL WHERE slug = $1", slug); err != nil {
+			return models.MembershipChanges{}, fmt.Errorf("failed to update rule of segment '%s': %w", slug, err)
+		}
+		return models.MembershipChanges{}, nil
+	}
+
+	expr, err := compileRule(ctx, tx, ruleText)
+	if err != nil {
+		return models.MembershipChanges{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE segments SET rule = $2 WHERE slug = $1", slug, ruleText); err != nil {
+		return models.MembershipChanges{}, fmt.Errorf("failed to update rule of segment '%s': %w", slug, err)
+	}
+
+	return db.applySegmentRule(ctx, tx, slug, expr)
+}
+
+// applySegmentRule приводит участников сегмента в соответствие с правилом. Правило переводится в условие над атрибутами
+// пользователей и вычисляется базой данных, поэтому пользователи не загружаются в память сервиса.
+func (db *DB) applySegmentRule(ctx context.Context, tx *sql.Tx, slug string, expr rule.Expr) (models.MembershipChanges, error) {
+	var changes models.MembershipChanges
+
+	predicate, args := rule.SQL(expr, "u.attributes", []interface{}{slug})
+
+	var err error
+	changes.Added, err = db.insertUserSegments(ctx, tx,
+		`SELECT u.id, s.slug, s.expiration_date FROM users u JOIN segments s ON s.slug = $1 WHERE `+predicate,
+		args...,
+	)
+	if err != nil {
+		return changes, fmt.Errorf("failed to apply rule of segment '%s': %w", slug, err)
+	}
+
+	changes.Removed, err = deleteUserSegments(ctx, tx,
+		`SELECT us.user_id, us.segment_slug FROM user_segments us
+         JOIN users u ON u.id = us.user_id
+         WHERE us.segment_slug = $1 AND NOT `+predicate,
+		args...,
+	)
+	if err != nil {
+		return changes, fmt.Errorf("failed to apply rule of segment '%s': %w", slug, err)
+	}
+
+	return changes, nil
+}
+
+// applyUserRules пересчитывает участие пользователей во всех активных сегментах с правилами
+func (db *DB) applyUserRules(ctx context.Context, tx *sql.Tx, userIDs []int64) (models.MembershipChanges, error) {
+	var changes models.MembershipChanges
+
+	segments, err := loadRuleSegments(ctx, tx)
+	if err != nil || len(segments) == 0 {
+		return changes, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, attributes FROM users WHERE id = ANY($1::int[])", pq.Array(userIDs))
+	if err != nil {
+		return changes, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	// Пары (пользователь, сегмент), которые должны существовать после пересчета
+	matchedUsers := []int64{}
+	matchedSlugs := []string{}
+	for rows.Next() {
+		userID, attributes, err := scanUserAttributes(rows)
+		if err != nil {
+			return changes, err
+		}
+		for _, segment := range segments {
+			if rule.Eval(segment.expr, attributes) {
+				matchedUsers = append(matchedUsers, userID)
+				matchedSlugs = append(matchedSlugs, segment.slug)
+			}
+		}
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return changes, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+	rows.Close()
+
+	changes.Added, err = db.insertUserSegments(ctx, tx,
+		`SELECT m.user_id, s.slug, s.expiration_date
+         FROM unnest($1::int[], $2::text[]) AS m(user_id, segment_slug)
+         JOIN segments s ON s.slug = m.segment_slug`,
+		pq.Array(matchedUsers), pq.Array(matchedSlugs),
+	)
+	if err != nil {
+		return changes, fmt.Errorf("failed to apply segment rules: %w", err)
+	}
+
+	changes.Removed, err = deleteUserSegments(ctx, tx,
+		`SELECT us.user_id, us.segment_slug FROM user_segments us
+         JOIN segments s ON s.slug = us.segment_slug
+         WHERE s.rule IS NOT NULL AND (s.expiration_date IS NULL OR s.expiration_date > NOW())
+           AND us.user_id = ANY($1::int[])
+           AND (us.user_id, us.segment_slug) NOT IN (
+               SELECT * FROM unnest($2::int[], $3::text[])
+           )`,
+		pq.Array(userIDs), pq.Array(matchedUsers), pq.Array(matchedSlugs),
+	)
+	if err != nil {
+		return changes, fmt.Errorf("failed to apply segment rules: %w", err)
+	}
+
+	return changes, nil
+}
+
+// compileRule разбирает правило и проверяет его типы по схеме атрибутов.
+// Ошибка содержит *rule.Error с позицией в правиле.
+func compileRule(ctx context.Context, tx *sql.Tx, ruleText string) (rule.Expr, error) {
+	schema, err := loadAttributeSchema(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := rule.Parse(ruleText)
+	if err == nil {
+		err = rule.Check(expr, schema)
+	}
+	if err != nil {
+		return nil, newError(ErrValidation, "invalid rule: %w", err)
+	}
+
+	return expr, nil
+}
+
+// validateAttributes проверяет атрибуты пользователей по схеме атрибутов
+func validateAttributes(ctx context.Context, tx *sql.Tx, attributes ...map[string]interface{}) error {
+	schema, err := loadAttributeSchema(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attributes {
+		if err := schema.Validate(a); err != nil {
+			return newError(ErrValidation, "%w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadAttributeSchema возвращает схему атрибутов в рамках транзакции
+func loadAttributeSchema(ctx context.Context, tx *sql.Tx) (rule.Schema, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name, type FROM attribute_schema")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attribute schema: %w", err)
+	}
+	defer rows.Close()
+
+	schema := rule.Schema{}
+	for rows.Next() {
+		var name, attributeType string
+		if err := rows.Scan(&name, &attributeType); err != nil {
+			return nil, fmt.Errorf("failed to scan attribute schema: %w", err)
+		}
+		schema[name] = rule.Type(attributeType)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return schema, nil
+}
+
+// loadRuleSegments возвращает неистекшие сегменты с правилами
+func loadRuleSegments(ctx context.Context, tx *sql.Tx) ([]ruleSegment, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT slug, rule FROM segments WHERE rule IS NOT NULL AND (expiration_date IS NULL OR expiration_date > NOW())",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rule-based segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []ruleSegment
+	for rows.Next() {
+		var slug, ruleText string
+		if err := rows.Scan(&slug, &ruleText); err != nil {
+			return nil, fmt.Errorf("failed to scan rule-based segment: %w", err)
+		}
+
+		// Правила проверяются при сохранении, поэтому ошибка здесь означает повреждение данных
+		expr, err := rule.Parse(ruleText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule of segment '%s': %w", slug, err)
+		}
+		segments = append(segments, ruleSegment{slug: slug, expr: expr})
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return segments, nil
+}
+
+// scanUserAttributes читает строку (id, attributes) и декодирует атрибуты пользователя
+func scanUserAttributes(rows *sql.Rows) (int64, map[string]interface{}, error) {
+	var userID int64
+	var raw []byte
+	if err := rows.Scan(&userID, &raw); err != nil {
+		return 0, nil, fmt.Errorf("failed to scan user attributes: %w", err)
+	}
+
+	var attributes map[string]interface{}
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return 0, nil, fmt.Errorf("failed to decode attributes of user with ID '%d': %w", userID, err)
+	}
+
+	return userID, attributes, nil
+}
+
+// encodeAttributes кодирует атрибуты пользователя в JSON-объект
+func encodeAttributes(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode user attributes: %w", err)
+	}
+
+	return string(encoded), nil
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"user-segmentation-service/internal/models"
+)
+
+// segmentCursor позиция в списке сегментов: slug последнего возвращенного сегмента
+type segmentCursor struct {
+	Slug string `json:"s"`
+}
+
+// segmentStatus вычисляет статус сегмента s (см. models.SegmentActive и др.)
+const segmentStatus = `CASE
+           WHEN s.expiration_date <= NOW() THEN '` + models.SegmentExpired + `'
+           WHEN EXISTS (SELECT 1 FROM segment_rollouts r
+                        WHERE r.segment_slug = s.slug AND r.status IN ('` + models.RolloutActive + `', '` + models.RolloutPaused + `'))
+               THEN '` + models.SegmentRollingOut + `'
+           ELSE '` + models.SegmentActive + `'
+       END`
+
+// segmentSummaryColumns столбцы сегмента вместе с его статусом и количеством неистекших участников
+const segmentSummaryColumns = `s.slug, s.created_at, s.expiration_date, s.random_percentage, s.bucketing,
+       s.rule, s.exclusion_group, s.tags, ` + segmentStatus + `,
+       (SELECT COUNT(*) FROM user_segments us
+        WHERE us.segment_slug = s.slug AND (us.expiration_date IS NULL OR us.expiration_date > NOW()))`
+
+// GetSegment возвращает сегмент, количество его участников и количество добавлений и удалений за последние 30 дней
+func (db *DB) GetSegment(ctx context.Context, slug string) (models.SegmentDetails, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, "SELECT "+segmentSummaryColumns+" FROM segments s WHERE s.slug = $1", slug)
+	if err != nil {
+		return models.SegmentDetails{}, fmt.Errorf("failed to query segment with slug '%s': %w", slug, err)
+	}
+
+	segments, err := scanSegmentSummaries(rows)
+	if err != nil {
+		return models.SegmentDetails{}, err
+	}
+	if len(segments) == 0 {
+		return models.SegmentDetails{}, newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+	}
+
+	segment := models.SegmentDetails{SegmentSummary: segments[0]}
+
+	// Истечение срока участия считается удалением из сегмента
+	err = db.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FILTER (WHERE operation = 'add'),
+                COUNT(*) FILTER (WHERE operation IN ('remove', 'expire'))
+         FROM user_segment_history
+         WHERE segment_slug = $1 AND operation_date >= NOW() - INTERVAL '30 days'`,
+		slug,
+	).Scan(&segment.AddedLast30Days, &segment.RemovedLast30Days)
+	if err != nil {
+		return models.SegmentDetails{}, fmt.Errorf("failed to count history of segment '%s': %w", slug, err)
+	}
+
+	rows, err = db.db.QueryContext(ctx,
+		"SELECT name, weight FROM segment_variants WHERE segment_slug = $1 ORDER BY position",
+		slug,
+	)
+	if err != nil {
+		return models.SegmentDetails{}, fmt.Errorf("failed to query variants of segment '%s': %w", slug, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant models.Variant
+		if err := rows.Scan(&variant.Name, &variant.Weight); err != nil {
+			return models.SegmentDetails{}, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		segment.Variants = append(segment.Variants, variant)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return models.SegmentDetails{}, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return segment, nil
+}
+
+// ListSegments возвращает страницу сегментов, отсортированных по slug, с фильтрами по префиксу slug, тегу и статусу.
+// Как и в ListUsers, используется keyset-пагинация по slug последнего сегмента страницы.
+func (db *DB) ListSegments(ctx context.Context, query models.SegmentsQuery) (models.SegmentsPage, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var conditions []string
+	var args []interface{}
+
+	if query.SlugPrefix != "" {
+		args = append(args, escapeLike(query.SlugPrefix)+"%")
+		conditions = append(conditions, fmt.Sprintf(`s.slug COLLATE "C" LIKE $%d`, len(args)))
+	}
+
+	if query.Tag != "" {
+		args = append(args, pq.StringArray{query.Tag})
+		conditions = append(conditions, fmt.Sprintf("s.tags @> $%d", len(args)))
+	}
+
+	switch query.Status {
+	case "":
+	case models.SegmentActive, models.SegmentRollingOut, models.SegmentExpired:
+		args = append(args, query.Status)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", segmentStatus, len(args)))
+	default:
+		return models.SegmentsPage{}, newError(ErrValidation, "unknown segment status '%s'", query.Status)
+	}
+
+	// Продолжение со следующего после курсора сегмента
+	if query.Cursor != "" {
+		var after segmentCursor
+		if err := decodeCursor(query.Cursor, &after); err != nil {
+			return models.SegmentsPage{}, err
+		}
+
+		args = append(args, after.Slug)
+		conditions = append(conditions, fmt.Sprintf(`s.slug COLLATE "C" > $%d`, len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Выбирается на один сегмент больше, чтобы узнать, есть ли следующая страница
+	args = append(args, query.Limit+1)
+	rows, err := db.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s FROM segments s %s ORDER BY s.slug COLLATE "C" LIMIT $%d`, segmentSummaryColumns, where, len(args)),
+		args...,
+	)
+	if err != nil {
+		return models.SegmentsPage{}, fmt.Errorf("failed to query segments: %w", err)
+	}
+
+	segments, err := scanSegmentSummaries(rows)
+	if err != nil {
+		return models.SegmentsPage{}, err
+	}
+
+	page := models.SegmentsPage{Segments: segments}
+	if len(segments) > query.Limit {
+		page.Segments = segments[:query.Limit]
+
+		after := segmentCursor{Slug: page.Segments[len(page.Segments)-1].Slug}
+		if page.NextCursor, err = encodeCursor(after); err != nil {
+			return models.SegmentsPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// scanSegmentSummaries читает сегменты, выбранные по столбцам segmentSummaryColumns, и закрывает rows
+func scanSegmentSummaries(rows *sql.Rows) ([]models.SegmentSummary, error) {
+	defer rows.Close()
+
+	segments := []models.SegmentSummary{}
+	for rows.Next() {
+		var segment models.SegmentSummary
+		var expirationDate sql.NullTime
+		var segmentRule, exclusionGroup sql.NullString
+		var tags pq.StringArray
+		if err := rows.Scan(&segment.Slug, &segment.CreatedAt, &expirationDate, &segment.RandomPercentage,
+			&segment.Bucketing, &segmentRule, &exclusionGroup, &tags, &segment.Status, &segment.MemberCount); err != nil {
+			return nil, fmt.Errorf("failed to scan segment: %w", err)
+		}
+		segment.ExpirationDate = expirationDate.Time
+		segment.Rule = segmentRule.String
+		segment.ExclusionGroup = exclusionGroup.String
+		segment.Tags = append([]string{}, tags...)
+		segments = append(segments, segment)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return segments, nil
+}
+
+// memberCursor позиция в списке участников сегмента: ID последнего возвращенного пользователя
+type memberCursor struct {
+	UserID int64 `json:"u"`
+}
+
+// segmentMembers выбирает неистекших участников сегмента $1 с ID больше $2 в порядке ID
+const segmentMembers = `SELECT us.user_id, u.name, us.added_at, us.expiration_date, COALESCE(us.variant, '')
+         FROM user_segments us JOIN users u ON u.id = us.user_id
+         WHERE us.segment_slug = $1 AND us.user_id > $2 AND (us.expiration_date IS NULL OR us.expiration_date > NOW())
+         ORDER BY us.user_id`
+
+// ListSegmentMembers возвращает страницу участников сегмента, отсортированных по ID пользователя
+func (db *DB) ListSegmentMembers(ctx context.Context, query models.SegmentMembersQuery) (models.SegmentMembersPage, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var after memberCursor
+	if query.Cursor != "" {
+		if err := decodeCursor(query.Cursor, &after); err != nil {
+			return models.SegmentMembersPage{}, err
+		}
+	}
+
+	if err := db.checkSegmentExists(ctx, query.Slug); err != nil {
+		return models.SegmentMembersPage{}, err
+	}
+
+	// Выбирается на одного участника больше, чтобы узнать, есть ли следующая страница
+	rows, err := db.db.QueryContext(ctx, segmentMembers+" LIMIT $3", query.Slug, after.UserID, query.Limit+1)
+	if err != nil {
+		return models.SegmentMembersPage{}, fmt.Errorf("failed to query members of segment '%s': %w", query.Slug, err)
+	}
+	defer rows.Close()
+
+	page := models.SegmentMembersPage{Users: []models.SegmentMember{}}
+	for rows.Next() {
+		member, err := scanSegmentMember(rows)
+		if err != nil {
+			return models.SegmentMembersPage{}, err
+		}
+		page.Users = append(page.Users, member)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return models.SegmentMembersPage{}, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	if len(page.Users) > query.Limit {
+		page.Users = page.Users[:query.Limit]
+
+		after := memberCursor{UserID: page.Users[len(page.Users)-1].UserID}
+		if page.NextCursor, err = encodeCursor(after); err != nil {
+			return models.SegmentMembersPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// StreamSegmentMembers передает fn всех участников сегмента в порядке ID пользователя по мере чтения из базы данных,
+// не загружая их в память. Выгрузка может занимать больше PG_QUERY_TIMEOUT, поэтому ограничена только отменой ctx.
+// Ошибка fn прерывает выгрузку и возвращается без изменений.
+func (db *DB) StreamSegmentMembers(ctx context.Context, slug string, fn func(models.SegmentMember) error) error {
+	if err := db.checkSegmentExists(ctx, slug); err != nil {
+		return err
+	}
+
+	rows, err := db.db.QueryContext(ctx, segmentMembers, slug, 0)
+	if err != nil {
+		return fmt.Errorf("failed to query members of segment '%s': %w", slug, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member, err := scanSegmentMember(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(member); err != nil {
+			return err
+		}
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return nil
+}
+
+// checkSegmentExists возвращает ErrNotFound, если сегмента со slug нет
+func (db *DB) checkSegmentExists(ctx context.Context, slug string) error {
+	var exists bool
+	if err := db.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM segments WHERE slug = $1)", slug).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query existing segment: %w", err)
+	}
+	if !exists {
+		return newError(ErrNotFound, "segment with slug '%s' does not exist", slug)
+	}
+
+	return nil
+}
+
+// scanSegmentMember читает участника сегмента, выбранного запросом segmentMembers
+func scanSegmentMember(rows *sql.Rows) (models.SegmentMember, error) {
+	var member models.SegmentMember
+	var expirationDate sql.NullTime
+	if err := rows.Scan(&member.UserID, &member.Name, &member.AddedAt, &expirationDate, &member.Variant); err != nil {
+		return models.SegmentMember{}, fmt.Errorf("failed to scan segment member: %w", err)
+	}
+	if expirationDate.Valid {
+		member.ExpirationDate = &expirationDate.Time
+	}
+
+	return member, nil
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"user-segmentation-service/internal/models"
+)
+
+// userCursor позиция в списке пользователей: ключ сортировки последнего возвращенного пользователя
+type userCursor struct {
+	Sort string `json:"s"`
+	ID   int64  `json:"i"`
+	Name string `json:"n,omitempty"`
+}
+
+// userDetailsColumns столбцы пользователя вместе с количеством его неистекших сегментов
+const userDetailsColumns = `u.id, u.name, u.attributes,
+       (SELECT COUNT(*) FROM user_segments us
+        WHERE us.user_id = u.id AND (us.expiration_date IS NULL OR us.expiration_date > NOW()))`
+
+// GetUser возвращает пользователя и количество его текущих сегментов
+func (db *DB) GetUser(ctx context.Context, userID int) (models.UserDetails, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.db.QueryContext(ctx, "SELECT "+userDetailsColumns+" FROM users u WHERE u.id = $1", userID)
+	if err != nil {
+		return models.UserDetails{}, fmt.Errorf("failed to query user with ID '%d': %w", userID, err)
+	}
+
+	users, err := scanUserDetails(rows)
+	if err != nil {
+		return models.UserDetails{}, err
+	}
+	if len(users) == 0 {
+		return models.UserDetails{}, newError(ErrNotFound, "user with ID '%d' does not exist", userID)
+	}
+
+	return users[0], nil
+}
+
+// checkUserExists возвращает ErrNotFound, если пользователя с userID нет
+func (db *DB) checkUserExists(ctx context.Context, userID int) error {
+	var exists bool
+	if err := db.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query existing user: %w", err)
+	}
+	if !exists {
+		return newError(ErrNotFound, "user with ID '%d' does not exist", userID)
+	}
+
+	return nil
+}
+
+// ListUsers возвращает страницу пользователей, имя которых начинается с query.NamePrefix.
+// Используется keyset-пагинация: курсор хранит ключ сортировки последнего пользователя страницы,
+// поэтому время запроса не зависит от номера страницы.
+func (db *DB) ListUsers(ctx context.Context, query models.UsersQuery) (models.UsersPage, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	sort := query.Sort
+	if sort == "" {
+		sort = models.UserSortID
+	}
+
+	var sortKey, order, compare string
+	switch sort {
+	case models.UserSortID, models.UserSortName:
+		order, compare = "ASC", ">"
+	case "-" + models.UserSortID, "-" + models.UserSortName:
+		order, compare = "DESC", "<"
+	default:
+		return models.UsersPage{}, newError(ErrValidation, "unknown sort '%s'", sort)
+	}
+	byName := strings.TrimPrefix(sort, "-") == models.UserSortName
+	if byName {
+		sortKey = `(u.name COLLATE "C", u.id)`
+	} else {
+		sortKey = "u.id"
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if query.NamePrefix != "" {
+		args = append(args, escapeLike(query.NamePrefix)+"%")
+		conditions = append(conditions, fmt.Sprintf(`u.name COLLATE "C" LIKE $%d`, len(args)))
+	}
+
+	// Продолжение со следующего после курсора пользователя
+	if query.Cursor != "" {
+		var after userCursor
+		if err := decodeCursor(query.Cursor, &after); err != nil {
+			return models.UsersPage{}, err
+		}
+		if after.Sort != sort {
+			return models.UsersPage{}, newError(ErrValidation, "cursor does not match sort '%s'", sort)
+		}
+
+		if byName {
+			args = append(args, after.Name, after.ID)
+			conditions = append(conditions, fmt.Sprintf("%s %s ($%d, $%d)", sortKey, compare, len(args)-1, len(args)))
+		} else {
+			args = append(args, after.ID)
+			conditions = append(conditions, fmt.Sprintf("%s %s $%d", sortKey, compare, len(args)))
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	orderBy := "u.id " + order
+	if byName {
+		orderBy = `u.name COLLATE "C" ` + order + ", u.id " + order
+	}
+
+	// Выбирается на одного пользователя больше, чтобы узнать, есть ли следующая страница
+	args = append(args, query.Limit+1)
+	rows, err := db.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT %s FROM users u %s ORDER BY %s LIMIT $%d", userDetailsColumns, where, orderBy, len(args)),
+		args...,
+	)
+	if err != nil {
+		return models.UsersPage{}, fmt.Errorf("failed to query users: %w", err)
+	}
+
+	users, err := scanUserDetails(rows)
+	if err != nil {
+		return models.UsersPage{}, err
+	}
+
+	page := models.UsersPage{Users: users}
+	if len(users) > query.Limit {
+		page.Users = users[:query.Limit]
+		last := page.Users[len(page.Users)-1]
+
+		after := userCursor{Sort: sort, ID: last.ID}
+		if byName {
+			after.Name = last.Name
+		}
+		if page.NextCursor, err = encodeCursor(after); err != nil {
+			return models.UsersPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// scanUserDetails читает пользователей, выбранных по столбцам userDetailsColumns, и закрывает rows
+func scanUserDetails(rows *sql.Rows) ([]models.UserDetails, error) {
+	defer rows.Close()
+
+	users := []models.UserDetails{}
+	for rows.Next() {
+		var user models.UserDetails
+		var raw []byte
+		if err := rows.Scan(&user.ID, &user.Name, &raw, &user.SegmentCount); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if err := json.Unmarshal(raw, &user.Attributes); err != nil {
+			return nil, fmt.Errorf("failed to decode attributes of user with ID '%d': %w", user.ID, err)
+		}
+		users = append(users, user)
+	}
+
+	// Проверка наличия дополнительных ошибок
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while reading rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
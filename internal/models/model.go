@@ -2,14 +2,244 @@ package models
 
 import "time"
 
+// Способы выбора пользователей, попадающих в сегмент по random_percentage
+const (
+	BucketingRandom = "random" // случайная выборка при создании сегмента
+	BucketingHash   = "hash"   // детерминированная корзина по хешу (соль, slug, ID пользователя)
+)
+
 type User struct {
-	Name string `json:"name"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 type Segment struct {
 	Slug             string    `json:"slug"`
 	ExpirationDate   time.Time `json:"expiration_date"`
 	RandomPercentage float64   `json:"random_percentage"`
+	Bucketing        string    `json:"bucketing"`
+	Rule             string    `json:"rule,omitempty"`
+	ExclusionGroup   string    `json:"exclusion_group,omitempty"`
+	Variants         []Variant `json:"variants,omitempty"`
+	Tags             []string  `json:"tags,omitempty"`
+}
+
+// Variant вариант эксперимента; пользователь сегмента получает вариант с вероятностью, пропорциональной весу
+type Variant struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// UserDetails пользователь с количеством его текущих (неистекших) сегментов
+type UserDetails struct {
+	ID           int64                  `json:"id"`
+	Name         string                 `json:"name"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	SegmentCount int                    `json:"segment_count"`
+}
+
+// Поля сортировки списка пользователей; "-" перед полем означает сортировку по убыванию
+const (
+	UserSortID   = "id"
+	UserSortName = "name"
+)
+
+// UsersQuery параметры списка пользователей
+type UsersQuery struct {
+	NamePrefix string
+	Sort       string
+	Limit      int
+	Cursor     string
+}
+
+// UsersPage страница списка пользователей; NextCursor пуст на последней странице
+type UsersPage struct {
+	Users      []UserDetails `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Статусы сегмента; статус не хранится, а вычисляется при чтении
+const (
+	SegmentActive     = "active"      // пользователи добавляются в сегмент и остаются в нем
+	SegmentRollingOut = "rolling_out" // у сегмента есть незавершенный план раскатки
+	SegmentExpired    = "expired"     // срок действия участия по умолчанию истек
+)
+
+// SegmentSummary сегмент в списке сегментов
+type SegmentSummary struct {
+	Slug             string    `json:"slug"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpirationDate   time.Time `json:"expiration_date"`
+	RandomPercentage float64   `json:"random_percentage"`
+	Bucketing        string    `json:"bucketing"`
+	Rule             string    `json:"rule,omitempty"`
+	ExclusionGroup   string    `json:"exclusion_group,omitempty"`
+	Tags             []string  `json:"tags"`
+	Status           string    `json:"status"`
+	MemberCount      int       `json:"member_count"`
+}
+
+// SegmentDetails сегмент с вариантами и количеством изменений участников за последние 30 дней
+type SegmentDetails struct {
+	SegmentSummary
+	Variants        []Variant `json:"variants,omitempty"`
+	AddedLast30Days int       `json:"added_last_30_days"`
+	// Удаления, включая истечение срока участия
+	RemovedLast30Days int `json:"removed_last_30_days"`
+}
+
+// SegmentsQuery параметры списка сегментов; пустые поля не ограничивают выборку
+type SegmentsQuery struct {
+	SlugPrefix string
+	Tag        string
+	Status     string
+	Limit      int
+	Cursor     string
+}
+
+// SegmentsPage страница списка сегментов, отсортированного по slug; NextCursor пуст на последней странице
+type SegmentsPage struct {
+	Segments   []SegmentSummary `json:"segments"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// SegmentMember участник сегмента
+type SegmentMember struct {
+	UserID         int64      `json:"user_id"`
+	Name           string     `json:"name"`
+	AddedAt        time.Time  `json:"added_at"`
+	ExpirationDate *time.Time `json:"expiration_date,omitempty"`
+	Variant        string     `json:"variant,omitempty"`
+}
+
+// SegmentMembersQuery параметры списка участников сегмента
+type SegmentMembersQuery struct {
+	Slug   string
+	Limit  int
+	Cursor string
+}
+
+// SegmentMembersPage страница участников сегмента, отсортированных по ID; NextCursor пуст на последней странице
+type SegmentMembersPage struct {
+	Users      []SegmentMember `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// SegmentEvent событие истории сегмента: добавление (add), удаление (remove) или истечение участия (expire) пользователя
+type SegmentEvent struct {
+	UserID        int64     `json:"user_id"`
+	Operation     string    `json:"operation"`
+	OperationDate time.Time `json:"operation_date"`
+	Variant       string    `json:"variant,omitempty"`
+}
+
+// ReportPeriod период истории [From, To). Дни периода и даты в отчетах считаются в часовом поясе Location
+type ReportPeriod struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// SegmentHistoryQuery параметры постраничного вывода истории сегмента за период
+type SegmentHistoryQuery struct {
+	Slug   string
+	Period ReportPeriod
+	Limit  int
+	Cursor string
+}
+
+type SegmentHistoryPage struct {
+	Events     []SegmentEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// SegmentDay изменения сегмента за день и его размер на конец дня
+type SegmentDay struct {
+	Date   string `json:"date"`
+	Joins  int    `json:"joins"`
+	Leaves int    `json:"leaves"`
+	Net    int    `json:"net"`
+	Size   int    `json:"size"`
+}
+
+type CreateUsersRequest struct {
+	Users []User `json:"users"`
+}
+
+// UpdateSegmentRequest изменяемые параметры существующего сегмента
+type UpdateSegmentRequest struct {
+	RandomPercentage *float64 `json:"random_percentage"`
+	Rule             *string  `json:"rule"`
+}
+
+// MembershipChanges количество пользователей, добавленных в сегмент и удаленных из него
+type MembershipChanges struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// Статусы плана постепенной раскатки сегмента
+const (
+	RolloutActive    = "active"
+	RolloutPaused    = "paused"
+	RolloutAborted   = "aborted"
+	RolloutCompleted = "completed"
+)
+
+type RolloutStep struct {
+	Percentage float64    `json:"percentage"`
+	ApplyAt    time.Time  `json:"apply_at"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+	Added      int        `json:"added"`
+	Removed    int        `json:"removed"`
+}
+
+type RolloutRequest struct {
+	Steps []RolloutStep `json:"steps"`
+}
+
+// Rollout план постепенной раскатки сегмента и его текущее состояние
+type Rollout struct {
+	ID                int           `json:"id"`
+	SegmentSlug       string        `json:"segment_slug"`
+	Status            string        `json:"status"`
+	CurrentPercentage float64       `json:"current_percentage"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+	Steps             []RolloutStep `json:"steps"`
+}
+
+type UpdateUserAttributesRequest struct {
+	UserId     int                    `json:"user_id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type UserAttributes struct {
+	UserId     int                    `json:"user_id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type AttributeDefinition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// EvaluateRuleRequest пробное вычисление правила для пользователя (user_id) или случайной выборки (sample_size)
+type EvaluateRuleRequest struct {
+	Rule       string `json:"rule"`
+	UserId     *int   `json:"user_id"`
+	SampleSize int    `json:"sample_size"`
+}
+
+type RuleEvaluation struct {
+	UserId  int  `json:"user_id"`
+	Matched bool `json:"matched"`
+}
+
+// Holdout доля пользователей, которые не попадают в сегменты группы исключения (пустая группа – во все сегменты)
+type Holdout struct {
+	ExclusionGroup string  `json:"exclusion_group"`
+	Percentage     float64 `json:"percentage"`
 }
 
 type DeleteUserRequest struct {
@@ -20,13 +250,125 @@ type UserSegmentsRequest struct {
 	UserId int `json:"user_id"`
 }
 
+// BatchGetUserSegmentsRequest запрос сегментов нескольких пользователей
+type BatchGetUserSegmentsRequest struct {
+	UserIds        []int `json:"user_ids"`
+	IncludeExpired bool  `json:"include_expired"`
+}
+
+// BulkUpdateUserSegmentsRequest массовое изменение сегментов пользователей
+type BulkUpdateUserSegmentsRequest struct {
+	UserIds []int     `json:"user_ids"`
+	Add     []Segment `json:"add"`
+	Remove  []string  `json:"remove"`
+}
+
+// BulkFailure пользователь, которого не удалось добавить в сегмент при массовом изменении
+type BulkFailure struct {
+	UserID  int    `json:"user_id"`
+	Segment string `json:"segment,omitempty"`
+	Error   string `json:"error"`
+}
+
+// BulkUpdateResult итоги массового изменения сегментов пользователей.
+// Failures содержит не более 1000 первых ошибок, FailureCount – их общее количество.
+type BulkUpdateResult struct {
+	Users        int           `json:"users"`
+	Added        int           `json:"added"`
+	Removed      int           `json:"removed"`
+	FailureCount int           `json:"failure_count"`
+	Failures     []BulkFailure `json:"failures"`
+}
+
+// Режимы импорта участников сегмента из файла
+const (
+	ImportAppend  = "append"  // пользователи из файла добавляются к текущим участникам
+	ImportReplace = "replace" // участники, которых нет в файле, удаляются из сегмента
+)
+
+// ImportRejection строка файла импорта, пользователь из которой не добавлен в сегмент
+type ImportRejection struct {
+	Line   int    `json:"line"`
+	UserID int    `json:"user_id,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportResult итоги импорта участников сегмента: Rows = Added + Duplicates + Rejected.
+// Rejections содержит не более 100 первых отклоненных строк.
+type ImportResult struct {
+	Rows       int               `json:"rows"`
+	Added      int               `json:"added"`
+	Duplicates int               `json:"duplicates"`
+	Rejected   int               `json:"rejected"`
+	Removed    int               `json:"removed"`
+	Rejections []ImportRejection `json:"rejections"`
+}
+
+type UserSegment struct {
+	Slug           string     `json:"slug"`
+	AddedAt        time.Time  `json:"added_at"`
+	ExpirationDate *time.Time `json:"expiration_date"`
+	ExclusionGroup string     `json:"exclusion_group,omitempty"`
+	Variant        string     `json:"variant,omitempty"`
+}
+
 type UpdateSegmentsRequest struct {
 	UserId int       `json:"user_id"`
 	Add    []Segment `json:"add"`
 	Remove []string  `json:"remove"`
 }
 
+// Виды отчетов по истории: по пользователю и по сегменту
+const (
+	ReportUser    = "user"
+	ReportSegment = "segment"
+)
+
+// Статусы задания на создание отчета
+const (
+	ReportQueued  = "queued"
+	ReportRunning = "running"
+	ReportDone    = "done"
+	ReportFailed  = "failed"
+)
+
+// ReportJobRequest запрос на создание отчета в фоне: по пользователю UserID или сегменту SegmentSlug
+// за месяц Month (YYYY-MM) или период From–To
+type ReportJobRequest struct {
+	Type        string `json:"type"`
+	UserID      int    `json:"user_id"`
+	SegmentSlug string `json:"segment_slug"`
+	Month       string `json:"month"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// ReportJob задание на создание отчета за период [From, To) и его состояние. Progress – процент записанных строк.
+type ReportJob struct {
+	ID           int        `json:"id"`
+	Type         string     `json:"type"`
+	UserID       int        `json:"user_id,omitempty"`
+	SegmentSlug  string     `json:"segment_slug,omitempty"`
+	From         time.Time  `json:"from"`
+	To           time.Time  `json:"to"`
+	TimeZone     string     `json:"time_zone"`
+	Status       string     `json:"status"`
+	Progress     int        `json:"progress"`
+	RowsTotal    int        `json:"rows_total"`
+	RowsWritten  int        `json:"rows_written"`
+	Attempts     int        `json:"-"` // номер запуска задания; обработчик с устаревшим номером не может изменить задание
+	FileName     string     `json:"-"`
+	DownloadLink string     `json:"download_link,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReportRequest запрос отчета по истории пользователя за месяц YearMonth (YYYY-MM) или за период From–To
 type ReportRequest struct {
 	UserId    int    `json:"user_id"`
 	YearMonth string `json:"yearMonth"`
+	From      string `json:"from"`
+	To        string `json:"to"`
 }
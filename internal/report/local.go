@@ -0,0 +1,63 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Local хранилище отчетов в локальном каталоге, файлы которого раздает сам сервис.
+// Подходит только для одного экземпляра сервиса: файлы остаются на его диске.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal создаёт хранилище отчетов в каталоге dir; ссылки на файлы начинаются с baseURL
+func NewLocal(dir, baseURL string) *Local {
+	return &Local{dir: dir, baseURL: baseURL}
+}
+
+// Save записывает файл отчета во временный файл и переименовывает его после записи,
+// поэтому по ссылке не отдается частично записанный файл
+func (l *Local) Save(_ context.Context, name string, r io.Reader, _ int64) error {
+	// Создание директории для отчетов, если она не существует
+	if err := os.MkdirAll(l.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create reports directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(l.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create report file '%s': %w", name, err)
+	}
+	defer func() {
+		// После успешной записи временный файл уже переименован
+		if err := os.Remove(file.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("An error occurred while removing the temporary report file: %v\n", err)
+		}
+	}()
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("failed to write report file '%s': %w", name, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close report file '%s': %w", name, err)
+	}
+	if err := os.Rename(file.Name(), filepath.Join(l.dir, name)); err != nil {
+		return fmt.Errorf("failed to save report file '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// Link возвращает ссылку на файл отчета, раздаваемый сервисом
+func (l *Local) Link(name string) string {
+	return l.baseURL + url.PathEscape(name)
+}
@@ -0,0 +1,34 @@
+package report
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalSaveAndLink(t *testing.T) {
+	assertion := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "reports")
+	l := NewLocal(dir, "http://localhost:8080/user/report/")
+
+	for _, content := range []string{"first\n", "second\n"} {
+		err := l.Save(context.Background(), "report_user_3_report_2023-08.csv", strings.NewReader(content), int64(len(content)))
+		assertion.NoError(err)
+
+		saved, err := os.ReadFile(filepath.Join(dir, "report_user_3_report_2023-08.csv"))
+		assertion.NoError(err)
+		assertion.Equal(content, string(saved))
+	}
+
+	// Временные файлы не остаются в каталоге отчетов
+	entries, err := os.ReadDir(dir)
+	assertion.NoError(err)
+	assertion.Len(entries, 1)
+
+	assertion.Equal("http://localhost:8080/user/report/report_segment_AVITO%20VOICE.csv", l.Link("report_segment_AVITO VOICE.csv"))
+}
@@ -0,0 +1,234 @@
+package report
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"user-segmentation-service/config"
+)
+
+// Параметры подписи запросов AWS Signature Version 4
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+// maxLinkExpiry максимальный срок действия подписанной ссылки, допускаемый S3
+const maxLinkExpiry = 7 * 24 * time.Hour
+
+// S3 хранилище отчетов в бакете S3-совместимого хранилища (AWS S3, MinIO и др.). Запросы подписываются
+// AWS Signature Version 4, ссылки на скачивание – подписанные URL, действующие linkExpiry.
+type S3 struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	pathStyle  bool
+	linkExpiry time.Duration
+	client     *http.Client
+	now        func() time.Time
+}
+
+// NewS3 создаёт хранилище отчетов в бакете cfg.Bucket; запросы к хранилищу выполняются через client
+func NewS3(cfg config.S3, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint should be an absolute URL, got '%s'", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if cfg.LinkExpiry < time.Second || cfg.LinkExpiry > maxLinkExpiry {
+		return nil, fmt.Errorf("S3 link expiry should be between 1s and %s", maxLinkExpiry)
+	}
+
+	return &S3{
+		endpoint:   endpoint,
+		region:     cfg.Region,
+		bucket:     cfg.Bucket,
+		accessKey:  cfg.AccessKeyID,
+		secretKey:  cfg.SecretAccessKey,
+		pathStyle:  cfg.PathStyle,
+		linkExpiry: cfg.LinkExpiry,
+		client:     client,
+		now:        time.Now,
+	}, nil
+}
+
+// Save загружает файл отчета в бакет запросом PUT Object. Содержимое не хешируется (UNSIGNED-PAYLOAD),
+// чтобы не читать файл дважды; его целостность обеспечивает Content-Length и HTTPS.
+func (s *S3) Save(ctx context.Context, name string, r io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(name).String(), r)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request for report '%s': %w", name, err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	s.sign(req, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload report '%s': %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Тело ответа с ошибкой S3 в формате XML; его начала достаточно для диагностики
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload report '%s': %s: %s", name, resp.Status, body)
+	}
+
+	return nil
+}
+
+// Link возвращает подписанную ссылку на скачивание файла отчета, действующую linkExpiry с момента вызова
+func (s *S3) Link(name string) string {
+	now := s.now().UTC()
+	u := s.objectURL(name)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.linkExpiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, u.EscapedPath(), u.RawQuery, "host:" + u.Host + "\n", "host", unsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+
+	return u.String()
+}
+
+// objectURL возвращает адрес объекта name в бакете
+func (s *S3) objectURL(name string) *url.URL {
+	u := &url.URL{Scheme: s.endpoint.Scheme, Host: s.endpoint.Host}
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + name
+		u.RawPath = "/" + uriEncode(s.bucket, true) + "/" + uriEncode(name, false)
+	} else {
+		u.Host = s.bucket + "." + s.endpoint.Host
+		u.Path = "/" + name
+		u.RawPath = "/" + uriEncode(name, false)
+	}
+
+	return u
+}
+
+// sign подписывает запрос заголовком Authorization. Подписываются заголовок Host и все заголовки запроса;
+// хеш содержимого берется из заголовка X-Amz-Content-Sha256.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(), signedHeaders, req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.accessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+// scope возвращает область действия подписи: дату, регион и сервис
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature подписывает канонический запрос ключом, производным от секретного ключа, даты и региона
+func (s *S3) signature(now time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm, now.Format(amzDateFormat), s.scope(now), hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery кодирует параметры запроса, отсортированные по имени, как требует Signature Version 4
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// uriEncode кодирует все символы, кроме незарезервированных (RFC 3986) и, если encodeSlash = false, символа '/'
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
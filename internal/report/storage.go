@@ -0,0 +1,37 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"user-segmentation-service/config"
+)
+
+// Хранилища файлов отчетов
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Storage хранилище файлов отчетов
+type Storage interface {
+	// Save сохраняет файл отчета name размером size байт, заменяя существующий
+	Save(ctx context.Context, name string, r io.Reader, size int64) error
+
+	// Link возвращает ссылку на скачивание файла отчета name
+	Link(name string) string
+}
+
+// NewStorage создаёт хранилище отчетов, выбранное в настройках
+func NewStorage(cfg config.Report) (Storage, error) {
+	switch cfg.Storage {
+	case StorageLocal:
+		return NewLocal(cfg.Dir, cfg.Host), nil
+	case StorageS3:
+		return NewS3(cfg.S3, http.DefaultClient)
+	default:
+		return nil, fmt.Errorf("unknown report storage '%s'", cfg.Storage)
+	}
+}
@@ -0,0 +1,47 @@
+package rule
+
+// Expr узел дерева разбора выражения
+type Expr interface {
+	// Pos возвращает позицию узла в исходном выражении (с 1, в символах)
+	Pos() int
+}
+
+// Ident ссылка на атрибут пользователя
+type Ident struct {
+	Name     string
+	Position int
+}
+
+// Literal строковое, числовое или логическое значение
+type Literal struct {
+	Value    interface{}
+	Position int
+}
+
+// Not логическое отрицание
+type Not struct {
+	X        Expr
+	Position int
+}
+
+// Binary логическая операция (and, or) или сравнение (==, !=, <, <=, >, >=)
+type Binary struct {
+	Op       string
+	Left     Expr
+	Right    Expr
+	Position int
+}
+
+// In проверка вхождения значения в список литералов
+type In struct {
+	X        Expr
+	List     []*Literal
+	Negate   bool
+	Position int
+}
+
+func (e *Ident) Pos() int   { return e.Position }
+func (e *Literal) Pos() int { return e.Position }
+func (e *Not) Pos() int     { return e.Position }
+func (e *Binary) Pos() int  { return e.Position }
+func (e *In) Pos() int      { return e.Position }
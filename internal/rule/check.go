@@ -0,0 +1,163 @@
+package rule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type тип атрибута пользователя
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeNumber Type = "number"
+	TypeBool   Type = "bool"
+	TypeDate   Type = "date" // строка в формате YYYY-MM-DD
+)
+
+// DateLayout формат значений атрибутов типа date
+const DateLayout = "2006-01-02"
+
+// Schema известные атрибуты пользователей и их типы
+type Schema map[string]Type
+
+// ParseType проверяет название типа атрибута
+func ParseType(name string) (Type, error) {
+	switch t := Type(name); t {
+	case TypeString, TypeNumber, TypeBool, TypeDate:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown attribute type '%s', expected one of string, number, bool, date", name)
+}
+
+// Validate проверяет, что значения известных атрибутов соответствуют их типам.
+// Неизвестные атрибуты не проверяются, null означает удаление атрибута.
+func (s Schema) Validate(attributes map[string]interface{}) error {
+	for name, value := range attributes {
+		expected, ok := s[name]
+		if !ok || value == nil {
+			continue
+		}
+		if actual, ok := valueType(value, expected); !ok || actual != expected {
+			return fmt.Errorf("attribute '%s' should be of type %s", name, expected)
+		}
+	}
+	return nil
+}
+
+// Check проверяет типы выражения: атрибуты должны быть объявлены в схеме, операнды сравнения –
+// одного типа, упорядочивание допустимо только для чисел, строк и дат, а результат выражения – логический.
+func Check(expr Expr, schema Schema) error {
+	t, err := check(expr, schema, "")
+	if err != nil {
+		return err
+	}
+	if t != TypeBool {
+		return &Error{Pos: expr.Pos(), Msg: fmt.Sprintf("expression should be boolean, got %s", t)}
+	}
+	return nil
+}
+
+// check возвращает тип выражения; hint – ожидаемый тип, по которому строковый литерал может быть прочитан как дата
+func check(expr Expr, schema Schema, hint Type) (Type, error) {
+	switch e := expr.(type) {
+	case *Ident:
+		t, ok := schema[e.Name]
+		if !ok {
+			return "", &Error{Pos: e.Pos(), Msg: fmt.Sprintf("unknown attribute %q", e.Name)}
+		}
+		return t, nil
+
+	case *Literal:
+		t, ok := valueType(e.Value, hint)
+		if !ok {
+			return "", &Error{Pos: e.Pos(), Msg: fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", e.Value)}
+		}
+		return t, nil
+
+	case *Not:
+		if err := expect(e.X, schema, TypeBool, "operand of not"); err != nil {
+			return "", err
+		}
+		return TypeBool, nil
+
+	case *In:
+		t, err := check(e.X, schema, "")
+		if err != nil {
+			return "", err
+		}
+		for _, literal := range e.List {
+			if err := expect(literal, schema, t, "list element"); err != nil {
+				return "", err
+			}
+		}
+		return TypeBool, nil
+
+	case *Binary:
+		switch e.Op {
+		case "and", "or":
+			if err := expect(e.Left, schema, TypeBool, "operand of "+e.Op); err != nil {
+				return "", err
+			}
+			if err := expect(e.Right, schema, TypeBool, "operand of "+e.Op); err != nil {
+				return "", err
+			}
+			return TypeBool, nil
+		}
+
+		// Тип сравнения определяется атрибутом, чтобы строковый литерал справа мог быть датой
+		left, err := check(e.Left, schema, identType(e.Right, schema))
+		if err != nil {
+			return "", err
+		}
+		if err := expect(e.Right, schema, left, "right operand of "+e.Op); err != nil {
+			return "", err
+		}
+		if e.Op != "==" && e.Op != "!=" && left == TypeBool {
+			return "", &Error{Pos: e.Pos(), Msg: fmt.Sprintf("operator %s is not defined for bool", e.Op)}
+		}
+		return TypeBool, nil
+	}
+
+	return "", &Error{Pos: expr.Pos(), Msg: "unsupported expression"}
+}
+
+// expect проверяет, что выражение имеет тип expected
+func expect(expr Expr, schema Schema, expected Type, what string) error {
+	t, err := check(expr, schema, expected)
+	if err != nil {
+		return err
+	}
+	if t != expected {
+		return &Error{Pos: expr.Pos(), Msg: fmt.Sprintf("%s should be %s, got %s", what, expected, t)}
+	}
+	return nil
+}
+
+// identType возвращает тип атрибута, если выражение – ссылка на известный атрибут
+func identType(expr Expr, schema Schema) Type {
+	if ident, ok := expr.(*Ident); ok {
+		return schema[ident.Name]
+	}
+	return ""
+}
+
+// valueType возвращает тип значения; строка считается датой, если ожидается дата.
+// Второе значение false означает, что строка не является корректной датой.
+func valueType(value interface{}, hint Type) (Type, bool) {
+	switch v := value.(type) {
+	case float64:
+		return TypeNumber, true
+	case bool:
+		return TypeBool, true
+	case string:
+		if hint != TypeDate {
+			return TypeString, true
+		}
+		if _, err := time.Parse(DateLayout, v); err != nil {
+			return "", false
+		}
+		return TypeDate, true
+	}
+	return "", true
+}
@@ -0,0 +1,57 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	schema := Schema{
+		"country":     TypeString,
+		"plan":        TypeString,
+		"age":         TypeNumber,
+		"verified":    TypeBool,
+		"signup_date": TypeDate,
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"Valid", `country in ["RU", "KZ"] and plan == "pro"`, ""},
+		{"Valid Date", `signup_date >= "2023-08-01" and verified`, ""},
+		{"Valid Literal On The Left", `"pro" == plan`, ""},
+		{"Unknown Attribute", `city == "Moscow"`, `unknown attribute "city" at position 1`},
+		{"Type Mismatch", `age == "30"`, `right operand of == should be number, got string at position 8`},
+		{"Invalid Date", `signup_date > "yesterday"`, `invalid date "yesterday", expected YYYY-MM-DD at position 15`},
+		{"List Element Type", `country in ["RU", 7]`, `list element should be string, got number at position 19`},
+		{"Bool Ordering", `verified > false`, `operator > is not defined for bool at position 10`},
+		{"Not Boolean Operand", `plan and verified`, `operand of and should be bool, got string at position 1`},
+		{"Not Boolean Result", `plan`, `expression should be boolean, got string at position 1`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Parse(tc.expr)
+			assert.NoError(t, err)
+
+			err = Check(expr, schema)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{"age": TypeNumber, "signup_date": TypeDate}
+
+	assert.NoError(t, schema.Validate(map[string]interface{}{"age": 30.0, "signup_date": "2023-08-01", "city": "Moscow"}))
+	assert.NoError(t, schema.Validate(map[string]interface{}{"age": nil}))
+	assert.EqualError(t, schema.Validate(map[string]interface{}{"age": "30"}), "attribute 'age' should be of type number")
+	assert.EqualError(t, schema.Validate(map[string]interface{}{"signup_date": "01.08.2023"}), "attribute 'signup_date' should be of type date")
+}
@@ -0,0 +1,28 @@
+// Package rule реализует язык правил, по которым пользователи попадают в динамические сегменты.
+//
+// Выражение – логическая формула над атрибутами пользователя:
+//
+//	country in ["RU", "KZ"] and plan == "pro"
+//	not (age < 18) or signup_date >= "2023-08-01"
+//
+// Лексика:
+//   - идентификаторы (имена атрибутов): буквы, цифры и "_", начинаются с буквы или "_";
+//   - строки в двойных кавычках с экранированием как в Go ("a\"b");
+//   - числа: 10, -2.5;
+//   - ключевые слова (без учета регистра): and, or, not, in, true, false;
+//   - операторы: == != < <= > >= ( ) [ ] ,
+//
+// Приоритет операторов по убыванию: сравнения и in, not, and, or.
+// Грамматика приведена в описании Parse.
+//
+// Типы: string, number, bool и date (строка YYYY-MM-DD). Check проверяет выражение по схеме атрибутов:
+// все атрибуты должны быть объявлены, операнды сравнения и элементы списка in – одного типа с атрибутом,
+// <, <=, >, >= не определены для bool, а результат выражения должен быть логическим.
+//
+// При вычислении (Eval) отсутствующий у пользователя атрибут не равен ничему, поэтому любое сравнение с ним ложно,
+// включая != и not in.
+// SQL переводит выражение в условие PostgreSQL над атрибутами в jsonb с тем же результатом, что и Eval,
+// чтобы выбирать пользователей сегмента в базе данных.
+//
+// Ошибки разбора и проверки типов возвращаются как *Error с позицией (с 1, в символах) в исходном выражении.
+package rule
@@ -0,0 +1,95 @@
+package rule
+
+import "cmp"
+
+// Eval вычисляет выражение для атрибутов пользователя.
+// Значения атрибутов – результат декодирования JSON: string, float64, bool или nil.
+// Сравнение значений разных типов и отсутствующих атрибутов дает false.
+func Eval(expr Expr, attributes map[string]interface{}) bool {
+	value, ok := eval(expr, attributes).(bool)
+	return ok && value
+}
+
+func eval(expr Expr, attributes map[string]interface{}) interface{} {
+	switch e := expr.(type) {
+	case *Ident:
+		return attributes[e.Name]
+
+	case *Literal:
+		return e.Value
+
+	case *Not:
+		return !Eval(e.X, attributes)
+
+	case *In:
+		value := eval(e.X, attributes)
+		// Отсутствующий атрибут не входит ни в какой список, но и проверка not in для него ложна, как и сравнение !=
+		if value == nil {
+			return false
+		}
+		found := false
+		for _, literal := range e.List {
+			if equal(value, literal.Value) {
+				found = true
+				break
+			}
+		}
+		return found != e.Negate
+
+	case *Binary:
+		switch e.Op {
+		case "and":
+			return Eval(e.Left, attributes) && Eval(e.Right, attributes)
+		case "or":
+			return Eval(e.Left, attributes) || Eval(e.Right, attributes)
+		}
+
+		left, right := eval(e.Left, attributes), eval(e.Right, attributes)
+		switch e.Op {
+		case "==":
+			return equal(left, right)
+		case "!=":
+			return left != nil && right != nil && !equal(left, right)
+		}
+
+		cmp, ok := compare(left, right)
+		if !ok {
+			return false
+		}
+		switch e.Op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		}
+	}
+
+	return nil
+}
+
+// equal сравнивает значения одного типа
+func equal(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return false
+	}
+	return left == right
+}
+
+// compare упорядочивает числа и строки (даты в формате ISO 8601 сравниваются как строки)
+func compare(left, right interface{}) (int, bool) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return cmp.Compare(l, r), true
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return cmp.Compare(l, r), true
+		}
+	}
+	return 0, false
+}
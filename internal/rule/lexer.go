@@ -0,0 +1,151 @@
+package rule
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenTrue
+	tokenFalse
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenIn
+	tokenEq
+	tokenNe
+	tokenLt
+	tokenLe
+	tokenGt
+	tokenGe
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+// keywords ключевые слова языка; регистр не учитывается
+var keywords = map[string]tokenKind{
+	"and":   tokenAnd,
+	"or":    tokenOr,
+	"not":   tokenNot,
+	"in":    tokenIn,
+	"true":  tokenTrue,
+	"false": tokenFalse,
+}
+
+// operators операторы языка, двухсимвольные проверяются раньше односимвольных
+var operators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"==", tokenEq}, {"!=", tokenNe}, {"<=", tokenLe}, {">=", tokenGe},
+	{"<", tokenLt}, {">", tokenGt}, {"(", tokenLParen}, {")", tokenRParen},
+	{"[", tokenLBracket}, {"]", tokenRBracket}, {",", tokenComma},
+}
+
+type token struct {
+	kind  tokenKind
+	text  string // исходный текст токена
+	value interface{}
+	pos   int // позиция начала токена (с 1, в символах)
+}
+
+// lex разбивает выражение на токены
+func lex(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		pos := utf8.RuneCountInString(input[:i]) + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '"':
+			value, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, &Error{Pos: pos, Msg: err.Error()}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: input[i : i+n], value: value, pos: pos})
+			i += n
+
+		case unicode.IsDigit(r) || r == '-' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1])):
+			n := 1
+			for i+n < len(input) && (unicode.IsDigit(rune(input[i+n])) || input[i+n] == '.') {
+				n++
+			}
+			value, err := strconv.ParseFloat(input[i:i+n], 64)
+			if err != nil {
+				return nil, &Error{Pos: pos, Msg: "invalid number " + input[i:i+n]}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[i : i+n], value: value, pos: pos})
+			i += n
+
+		case unicode.IsLetter(r) || r == '_':
+			n := size
+			for i+n < len(input) {
+				next, nextSize := utf8.DecodeRuneInString(input[i+n:])
+				if !unicode.IsLetter(next) && !unicode.IsDigit(next) && next != '_' {
+					break
+				}
+				n += nextSize
+			}
+			text := input[i : i+n]
+			kind, ok := keywords[strings.ToLower(text)]
+			if !ok {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: pos})
+			i += n
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(input[i:], op.text) {
+					tokens = append(tokens, token{kind: op.kind, text: op.text, pos: pos})
+					i += len(op.text)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &Error{Pos: pos, Msg: "unexpected character " + strconv.QuoteRune(r)}
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: utf8.RuneCountInString(input) + 1})
+	return tokens, nil
+}
+
+// lexString читает строковый литерал в двойных кавычках и возвращает его значение и длину в байтах
+func lexString(input string) (string, int, error) {
+	escaped := false
+	for i := 1; i < len(input); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case input[i] == '\\':
+			escaped = true
+		case input[i] == '"':
+			value, err := strconv.Unquote(input[:i+1])
+			if err != nil {
+				return "", 0, errors.New("invalid string literal")
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, errors.New("unterminated string literal")
+}
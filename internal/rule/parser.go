@@ -0,0 +1,230 @@
+package rule
+
+import "fmt"
+
+// Error ошибка разбора выражения с позицией (с 1, в символах), в которой она обнаружена
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// Parse разбирает выражение и возвращает дерево разбора.
+//
+// Грамматика:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | primary
+//	primary    = "(" expr ")" | comparison
+//	comparison = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand | [ "not" ] "in" list ]
+//	operand    = IDENT | STRING | NUMBER | "true" | "false"
+//	list       = "[" [ literal { "," literal } ] "]"
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &Error{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// expect читает токен заданного вида или возвращает ошибку
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, unexpected(tok, what)
+	}
+	return tok, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "or", Left: left, Right: right, Position: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "and", Left: left, Right: right, Position: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek().kind == tokenNot {
+		op := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x, Position: op.pos}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	if p.peek().kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch tok.kind {
+	case tokenEq, tokenNe, tokenLt, tokenLe, tokenGt, tokenGe:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: tok.text, Left: left, Right: right, Position: tok.pos}, nil
+
+	case tokenIn:
+		p.next()
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &In{X: left, List: list, Position: tok.pos}, nil
+
+	case tokenNot:
+		// "not in" после операнда; одиночный "not" здесь недопустим
+		p.next()
+		if _, err := p.expect(tokenIn, `"in"`); err != nil {
+			return nil, err
+		}
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &In{X: left, List: list, Negate: true, Position: tok.pos}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseOperand() (Expr, error) {
+	tok := p.peek()
+	if tok.kind == tokenIdent {
+		p.next()
+		return &Ident{Name: tok.text, Position: tok.pos}, nil
+	}
+
+	return p.parseLiteral()
+}
+
+func (p *parser) parseLiteral() (*Literal, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return &Literal{Value: tok.value, Position: tok.pos}, nil
+	case tokenTrue:
+		return &Literal{Value: true, Position: tok.pos}, nil
+	case tokenFalse:
+		return &Literal{Value: false, Position: tok.pos}, nil
+	}
+
+	return nil, unexpected(tok, "attribute or value")
+}
+
+func (p *parser) parseList() ([]*Literal, error) {
+	if _, err := p.expect(tokenLBracket, `"["`); err != nil {
+		return nil, err
+	}
+
+	var list []*Literal
+	if p.peek().kind == tokenRBracket {
+		p.next()
+		return list, nil
+	}
+
+	for {
+		literal, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, literal)
+
+		tok := p.next()
+		if tok.kind == tokenRBracket {
+			return list, nil
+		}
+		if tok.kind != tokenComma {
+			return nil, unexpected(tok, `"," or "]"`)
+		}
+	}
+}
+
+// unexpected формирует ошибку о неожиданном токене
+func unexpected(tok token, expected string) error {
+	if tok.kind == tokenEOF {
+		return &Error{Pos: tok.pos, Msg: fmt.Sprintf("unexpected end of expression, expected %s", expected)}
+	}
+	return &Error{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q, expected %s", tok.text, expected)}
+}
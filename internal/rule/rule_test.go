@@ -0,0 +1,69 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	attributes := map[string]interface{}{
+		"country":     "RU",
+		"plan":        "pro",
+		"age":         float64(30),
+		"verified":    true,
+		"signup_date": "2023-08-15",
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{"In List", `country in ["RU", "KZ"]`, true},
+		{"Not In List", `country not in ["RU", "KZ"]`, false},
+		{"And", `country in ["RU","KZ"] and plan == "pro"`, true},
+		{"Or", `plan == "free" or age >= 18`, true},
+		{"Not", `not verified`, false},
+		{"Parentheses", `not (plan == "free" or age < 18)`, true},
+		{"Bare Boolean", `verified and age > 29.5`, true},
+		{"Date As String", `signup_date >= "2023-08-01" and signup_date < "2023-09-01"`, true},
+		{"Missing Attribute", `city == "Moscow"`, false},
+		{"Missing Attribute Not Equal", `city != "Moscow"`, false},
+		{"Missing Attribute In List", `city in ["Moscow"]`, false},
+		{"Missing Attribute Not In List", `city not in ["Moscow"]`, false},
+		{"Type Mismatch", `age == "30"`, false},
+		{"Type Mismatch Ordering", `plan > 10`, false},
+		{"Keywords Are Case Insensitive", `country IN ["RU"] AND NOT plan == "free"`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Parse(tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, Eval(expr, attributes))
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"Unexpected End", `country ==`, "unexpected end of expression, expected attribute or value at position 11"},
+		{"Unterminated String", `plan == "pro`, "unterminated string literal at position 9"},
+		{"Unexpected Character", `plan = "pro"`, "unexpected character '=' at position 6"},
+		{"Missing Bracket", `country in ["RU" "KZ"]`, `unexpected "\"KZ\"", expected "," or "]" at position 18`},
+		{"Missing Parenthesis", `(plan == "pro"`, `unexpected end of expression, expected ")" at position 15`},
+		{"Trailing Tokens", `plan == "pro" "free"`, `unexpected "\"free\"" at position 15`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.expr)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SQL переводит выражение в условие PostgreSQL над столбцом column типа jsonb с атрибутами пользователя.
+// Условие дает тот же результат, что и Eval, и никогда не равно NULL. Значения и имена атрибутов передаются
+// параметрами, которые дописываются к args; нумерация параметров продолжает args. Возвращает условие и параметры.
+func SQL(expr Expr, column string, args []interface{}) (string, []interface{}) {
+	c := &sqlCompiler{column: column, args: args}
+	return c.predicate(expr), c.args
+}
+
+type sqlCompiler struct {
+	column string
+	args   []interface{}
+}
+
+// param добавляет параметр и возвращает его ссылку
+func (c *sqlCompiler) param(value interface{}) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+// predicate переводит выражение в логическое условие, как Eval: значение, не равное true, – ложь
+func (c *sqlCompiler) predicate(expr Expr) string {
+	switch e := expr.(type) {
+	case *Ident:
+		return fmt.Sprintf("COALESCE(%s = 'true'::jsonb, FALSE)", c.operand(e))
+
+	case *Literal:
+		if e.Value == true {
+			return "TRUE"
+		}
+		return "FALSE"
+
+	case *Not:
+		return "(NOT " + c.predicate(e.X) + ")"
+
+	case *In:
+		// Отсутствующий атрибут (или JSON null) не входит ни в какой список, и not in для него тоже ложно
+		x := c.operand(e.X)
+		list := make([]string, 0, len(e.List))
+		for _, literal := range e.List {
+			list = append(list, c.operand(literal))
+		}
+		found := fmt.Sprintf("%s = ANY(ARRAY[%s]::jsonb[])", x, strings.Join(list, ", "))
+		if e.Negate {
+			found = "NOT (" + found + ")"
+		}
+		return fmt.Sprintf("COALESCE(jsonb_typeof(%s) <> 'null' AND %s, FALSE)", x, found)
+
+	case *Binary:
+		switch e.Op {
+		case "and", "or":
+			return fmt.Sprintf("(%s %s %s)", c.predicate(e.Left), strings.ToUpper(e.Op), c.predicate(e.Right))
+		}
+
+		// Значения jsonb равны, только если совпадают их типы; числа сравниваются по значению
+		left, right := c.operand(e.Left), c.operand(e.Right)
+		switch e.Op {
+		case "==":
+			return fmt.Sprintf("COALESCE(jsonb_typeof(%s) <> 'null' AND %s = %s, FALSE)", left, left, right)
+		case "!=":
+			return fmt.Sprintf("COALESCE(jsonb_typeof(%s) <> 'null' AND jsonb_typeof(%s) <> 'null' AND %s <> %s, FALSE)",
+				left, right, left, right)
+		}
+
+		// Упорядочиваются только два числа или две строки; строки сравниваются побайтно, как в Eval.
+		// CASE гарантирует, что к числу приводятся только числа.
+		return fmt.Sprintf(`CASE WHEN jsonb_typeof(%[1]s) = 'number' AND jsonb_typeof(%[2]s) = 'number'
+                      THEN (%[1]s #>> '{}')::numeric %[3]s (%[2]s #>> '{}')::numeric
+                 WHEN jsonb_typeof(%[1]s) = 'string' AND jsonb_typeof(%[2]s) = 'string'
+                      THEN (%[1]s #>> '{}') COLLATE "C" %[3]s (%[2]s #>> '{}') COLLATE "C"
+                 ELSE FALSE END`, left, right, e.Op)
+	}
+
+	return "FALSE"
+}
+
+// operand переводит атрибут или литерал в значение jsonb; отсутствующий атрибут – NULL
+func (c *sqlCompiler) operand(expr Expr) string {
+	switch e := expr.(type) {
+	case *Ident:
+		return fmt.Sprintf("(%s -> %s::text)", c.column, c.param(e.Name))
+	case *Literal:
+		return c.param(jsonValue(e.Value)) + "::jsonb"
+	}
+	return "NULL::jsonb"
+}
+
+// jsonValue кодирует значение литерала в JSON. Литералы – строки, конечные числа и логические значения,
+// поэтому кодирование не завершается ошибкой.
+func jsonValue(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,56 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		name         string
+		expr         string
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{
+			name:         "In List And Equality",
+			expr:         `country in ["RU", "KZ"] and plan == "pro"`,
+			expectedSQL:  `(COALESCE(jsonb_typeof((u.attributes -> $2::text)) <> 'null' AND (u.attributes -> $2::text) = ANY(ARRAY[$3::jsonb, $4::jsonb]::jsonb[]), FALSE) AND COALESCE(jsonb_typeof((u.attributes -> $5::text)) <> 'null' AND (u.attributes -> $5::text) = $6::jsonb, FALSE))`,
+			expectedArgs: []interface{}{"AVITO_PRO_RU", "country", `"RU"`, `"KZ"`, "plan", `"pro"`},
+		},
+		{
+			name:         "Not In List",
+			expr:         `country not in ["RU"]`,
+			expectedSQL:  `COALESCE(jsonb_typeof((u.attributes -> $2::text)) <> 'null' AND NOT ((u.attributes -> $2::text) = ANY(ARRAY[$3::jsonb]::jsonb[])), FALSE)`,
+			expectedArgs: []interface{}{"AVITO_PRO_RU", "country", `"RU"`},
+		},
+		{
+			name:         "Not Equal And Bare Boolean",
+			expr:         `not verified or plan != "free"`,
+			expectedSQL:  `((NOT COALESCE((u.attributes -> $2::text) = 'true'::jsonb, FALSE)) OR COALESCE(jsonb_typeof((u.attributes -> $3::text)) <> 'null' AND jsonb_typeof($4::jsonb) <> 'null' AND (u.attributes -> $3::text) <> $4::jsonb, FALSE))`,
+			expectedArgs: []interface{}{"AVITO_PRO_RU", "verified", "plan", `"free"`},
+		},
+		{
+			name: "Ordering",
+			expr: `age >= 18`,
+			expectedSQL: `CASE WHEN jsonb_typeof((u.attributes -> $2::text)) = 'number' AND jsonb_typeof($3::jsonb) = 'number'
+                      THEN ((u.attributes -> $2::text) #>> '{}')::numeric >= ($3::jsonb #>> '{}')::numeric
+                 WHEN jsonb_typeof((u.attributes -> $2::text)) = 'string' AND jsonb_typeof($3::jsonb) = 'string'
+                      THEN ((u.attributes -> $2::text) #>> '{}') COLLATE "C" >= ($3::jsonb #>> '{}') COLLATE "C"
+                 ELSE FALSE END`,
+			expectedArgs: []interface{}{"AVITO_PRO_RU", "age", "18"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Parse(tc.expr)
+			assert.NoError(t, err)
+
+			sql, args := SQL(expr, "u.attributes", []interface{}{"AVITO_PRO_RU"})
+			assert.Equal(t, tc.expectedSQL, sql)
+			assert.Equal(t, tc.expectedArgs, args)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+)
+
+// Форматы выгрузки участников сегмента
+const (
+	formatNDJSON = "ndjson" // JSON-объект участника на строку
+	formatCSV    = "csv"
+	formatJSON   = "json" // JSON-массив участников
+)
+
+// membersFlushInterval количество участников, после которого выгрузка отправляется клиенту
+const membersFlushInterval = 1000
+
+// memberExport параметры выгрузки участников сегмента
+type memberExport struct {
+	format            string
+	includeExpiration bool // добавлять дату истечения участия
+	gzip              bool // сжимать выгрузку gzip
+}
+
+// exportSegmentHandler выгружает всех участников сегмента со slug из пути запроса файлом в формате
+// ?format=csv|ndjson|json (по умолчанию csv), с ?gzip=true – сжатым gzip. Участники читаются из базы данных
+// и отправляются клиенту по мере чтения, без сохранения файла на сервере.
+func (a *App) exportSegmentHandler(ctx *gin.Context) {
+	export := memberExport{format: ctx.DefaultQuery("format", formatCSV), includeExpiration: true}
+
+	switch export.format {
+	case formatCSV, formatNDJSON, formatJSON:
+	default:
+		respondWithError(ctx, http.StatusBadRequest, "format should be one of csv, ndjson, json")
+		return
+	}
+
+	if value := ctx.Query("gzip"); value != "" {
+		var err error
+		if export.gzip, err = strconv.ParseBool(value); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, "gzip should be a boolean")
+			return
+		}
+	}
+
+	a.streamSegmentMembers(ctx, export)
+}
+
+// streamSegmentMembers выгружает всех участников сегмента, отправляя их клиенту по мере чтения из базы данных.
+// Ответ начинается с первого участника, поэтому ошибки до него (например, отсутствие сегмента) отправляются обычным JSON.
+func (a *App) streamSegmentMembers(ctx *gin.Context, export memberExport) {
+	slug := ctx.Param("slug")
+
+	var out io.Writer = ctx.Writer
+	var compressor *gzip.Writer
+	if export.gzip {
+		compressor = gzip.NewWriter(ctx.Writer)
+		out = compressor
+	}
+	encoder := json.NewEncoder(out)
+	w := csv.NewWriter(out)
+
+	// start отправляет заголовки ответа и начало файла: строку заголовков CSV или начало JSON-массива
+	started := false
+	start := func() error {
+		started = true
+
+		fileName := fmt.Sprintf("segment_%s_users.%s", slug, export.format)
+		switch {
+		case export.gzip:
+			fileName += ".gz"
+			ctx.Header("Content-Type", "application/gzip")
+		case export.format == formatCSV:
+			ctx.Header("Content-Type", "text/csv")
+		case export.format == formatNDJSON:
+			ctx.Header("Content-Type", "application/x-ndjson")
+		default:
+			ctx.Header("Content-Type", "application/json")
+		}
+		// Имя файла с пробелами, кавычками или не-ASCII символами slug экранируется или кодируется по RFC 2231
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+		ctx.Status(http.StatusOK)
+
+		switch export.format {
+		case formatCSV:
+			header := []string{"User ID", "Name", "Added At", "Variant"}
+			if export.includeExpiration {
+				header = append(header, "Expiration Date")
+			}
+			return w.Write(header)
+		case formatJSON:
+			_, err := io.WriteString(out, "[")
+			return err
+		}
+		return nil
+	}
+
+	// write отправляет участника в выбранном формате
+	written := 0
+	write := func(member models.SegmentMember) error {
+		if !export.includeExpiration {
+			member.ExpirationDate = nil
+		}
+
+		switch export.format {
+		case formatJSON:
+			if written > 0 {
+				if _, err := io.WriteString(out, ","); err != nil {
+					return err
+				}
+			}
+			return encoder.Encode(member)
+		case formatNDJSON:
+			return encoder.Encode(member)
+		}
+
+		record := []string{strconv.FormatInt(member.UserID, 10), member.Name, member.AddedAt.Format(time.RFC3339), member.Variant}
+		if export.includeExpiration {
+			expirationDate := ""
+			if member.ExpirationDate != nil {
+				expirationDate = member.ExpirationDate.Format(time.RFC3339)
+			}
+			record = append(record, expirationDate)
+		}
+		return w.Write(record)
+	}
+
+	// flush отправляет клиенту накопленную часть выгрузки
+	flush := func() error {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		if compressor != nil {
+			if err := compressor.Flush(); err != nil {
+				return err
+			}
+		}
+		ctx.Writer.Flush()
+		return nil
+	}
+
+	// finish завершает JSON-массив и сжатый поток
+	finish := func() error {
+		if export.format == formatJSON {
+			if _, err := io.WriteString(out, "]"); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if compressor != nil {
+			return compressor.Close()
+		}
+		return nil
+	}
+
+	err := a.db.StreamSegmentMembers(ctx.Request.Context(), slug, func(member models.SegmentMember) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := write(member); err != nil {
+			return err
+		}
+
+		written++
+		if written%membersFlushInterval == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = finish()
+	}
+
+	if err != nil {
+		if !started {
+			respondWithDBError(ctx, err)
+			return
+		}
+
+		// Часть ответа уже отправлена, поэтому клиент узнает об ошибке только по оборванной выгрузке
+		log.Printf("Failed to export members of segment '%s': %v\n", slug, err)
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestSegmentMembersExport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	expirationDate := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	members := []models.SegmentMember{
+		{UserID: 4, Name: "Maks", AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC), ExpirationDate: &expirationDate, Variant: "control"},
+		{UserID: 9, Name: "Maxim, Jr.", AddedAt: time.Date(2023, 8, 2, 12, 0, 0, 0, time.UTC)},
+	}
+
+	// stream передает участников в функцию выгрузки и возвращает err после них
+	stream := func(err error) func(context.Context, string, func(models.SegmentMember) error) error {
+		return func(_ context.Context, _ string, fn func(models.SegmentMember) error) error {
+			for _, member := range members {
+				if err := fn(member); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+
+	tests := []struct {
+		name                string
+		target              string
+		mockSetup           func()
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:   "Export NDJSON",
+			target: "/api/v2/segments/CHECKOUT_EXP/users?format=ndjson",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(stream(nil))
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"user_id":4,"name":"Maks","added_at":"2023-08-01T12:00:00Z","variant":"control"}
+{"user_id":9,"name":"Maxim, Jr.","added_at":"2023-08-02T12:00:00Z"}
+`,
+		},
+		{
+			name:   "Export CSV (include expiration)",
+			target: "/api/v2/segments/CHECKOUT_EXP/users?format=csv&include_expiration=true",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(stream(nil))
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: `User ID,Name,Added At,Variant,Expiration Date
+4,Maks,2023-08-01T12:00:00Z,control,2023-12-31T00:00:00Z
+9,"Maxim, Jr.",2023-08-02T12:00:00Z,,
+`,
+		},
+		{
+			name:   "Export CSV (empty segment)",
+			target: "/api/v2/segments/AVITO_SALE_10/users?format=csv",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "AVITO_SALE_10", gomock.Any()).Return(nil)
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody:        "User ID,Name,Added At,Variant\n",
+		},
+		{
+			name:   "Export JSON",
+			target: "/api/v2/segments/CHECKOUT_EXP/export?format=json",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(stream(nil))
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody: `[{"user_id":4,"name":"Maks","added_at":"2023-08-01T12:00:00Z","expiration_date":"2023-12-31T00:00:00Z","variant":"control"}
+,{"user_id":9,"name":"Maxim, Jr.","added_at":"2023-08-02T12:00:00Z"}
+]`,
+		},
+		{
+			name:   "Export JSON (empty segment)",
+			target: "/api/v2/segments/AVITO_SALE_10/export?format=json",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "AVITO_SALE_10", gomock.Any()).Return(nil)
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        "[]",
+		},
+		{
+			name:   "Export CSV (default format)",
+			target: "/api/v2/segments/CHECKOUT_EXP/export",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(stream(nil))
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: `User ID,Name,Added At,Variant,Expiration Date
+4,Maks,2023-08-01T12:00:00Z,control,2023-12-31T00:00:00Z
+9,"Maxim, Jr.",2023-08-02T12:00:00Z,,
+`,
+		},
+		{
+			name:                "Export Error (invalid format)",
+			target:              "/api/v2/segments/CHECKOUT_EXP/export?format=xml",
+			mockSetup:           func() {},
+			expectedCode:        http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedBody:        `{"code":"invalid_request","error":"format should be one of csv, ndjson, json"}`,
+		},
+		{
+			name:   "Export Error (segment does not exist)",
+			target: "/api/v2/segments/AVITO_SALE_666/users?format=ndjson",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "AVITO_SALE_666", gomock.Any()).Return(
+					dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode:        http.StatusNotFound,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedBody:        `{"code":"not_found","error":"segment with slug 'AVITO_SALE_666' does not exist"}`,
+		},
+		{
+			name:   "Export Error (connection lost during export)",
+			target: "/api/v2/segments/CHECKOUT_EXP/users?format=ndjson",
+			mockSetup: func() {
+				mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(stream(errors.New("connection reset")))
+			},
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"user_id":4,"name":"Maks","added_at":"2023-08-01T12:00:00Z","variant":"control"}
+{"user_id":9,"name":"Maxim, Jr.","added_at":"2023-08-02T12:00:00Z"}
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+			assertion.Equal(tc.expectedContentType, w.Header().Get("Content-Type"))
+			assertion.Equal(tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestSegmentExportGzip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), "CHECKOUT_EXP", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, fn func(models.SegmentMember) error) error {
+			return fn(models.SegmentMember{UserID: 4, Name: "Maks", AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)})
+		})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/segments/CHECKOUT_EXP/export?format=ndjson&gzip=true", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, r)
+
+	assertion := assert.New(t)
+	assertion.Equal(http.StatusOK, w.Code)
+	assertion.Equal("application/gzip", w.Header().Get("Content-Type"))
+	assertion.Equal("attachment; filename=segment_CHECKOUT_EXP_users.ndjson.gz", w.Header().Get("Content-Disposition"))
+
+	reader, err := gzip.NewReader(w.Body)
+	assertion.NoError(err)
+	content, err := io.ReadAll(reader)
+	assertion.NoError(err)
+	assertion.Equal(`{"user_id":4,"name":"Maks","added_at":"2023-08-01T12:00:00Z"}`+"\n", string(content))
+}
+
+func TestSegmentExportFileName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	tests := []struct {
+		name                string
+		slug                string
+		target              string
+		expectedDisposition string
+	}{
+		{
+			name:                "Plain Slug",
+			slug:                "CHECKOUT_EXP",
+			target:              "/api/v2/segments/CHECKOUT_EXP/export?format=csv",
+			expectedDisposition: "attachment; filename=segment_CHECKOUT_EXP_users.csv",
+		},
+		{
+			name:                "Slug With Space",
+			slug:                "AVITO VOICE",
+			target:              "/api/v2/segments/AVITO%20VOICE/export?format=csv",
+			expectedDisposition: `attachment; filename="segment_AVITO VOICE_users.csv"`,
+		},
+		{
+			name:                "Non-ASCII Slug",
+			slug:                "СКИДКА",
+			target:              "/api/v2/segments/%D0%A1%D0%9A%D0%98%D0%94%D0%9A%D0%90/export?format=csv",
+			expectedDisposition: "attachment; filename*=utf-8''segment_%D0%A1%D0%9A%D0%98%D0%94%D0%9A%D0%90_users.csv",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+
+			mockDB.EXPECT().StreamSegmentMembers(gomock.Any(), tc.slug, gomock.Any()).Return(nil)
+
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(http.StatusOK, w.Code)
+			assertion.Equal(tc.expectedDisposition, w.Header().Get("Content-Disposition"))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+)
+
+// segmentHistoryHandler возвращает страницу событий сегмента со slug из пути запроса за период
+// (?month= или ?from= и ?to=, см. parseReportPeriod) с курсором (?limit=, ?cursor=)
+func (a *App) segmentHistoryHandler(ctx *gin.Context) {
+	period, ok := a.queryReportPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	query := models.SegmentHistoryQuery{Slug: ctx.Param("slug"), Period: period, Cursor: ctx.Query("cursor")}
+	if query.Limit, ok = pageLimit(ctx); !ok {
+		return
+	}
+
+	page, err := a.db.ListSegmentHistory(ctx.Request.Context(), query)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// segmentDailyHistoryHandler возвращает количество добавлений и удалений сегмента со slug из пути запроса
+// и его размер по дням периода (?month= или ?from= и ?to=)
+func (a *App) segmentDailyHistoryHandler(ctx *gin.Context) {
+	period, ok := a.queryReportPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	days, err := a.db.GetSegmentDailyHistory(ctx.Request.Context(), ctx.Param("slug"), period)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"days": days})
+}
+
+// segmentReportHandler создает CSV отчет по событиям сегмента со slug из пути запроса за период
+// (?month= или ?from= и ?to=) и отправляет ссылку на него
+func (a *App) segmentReportHandler(ctx *gin.Context) {
+	period, ok := a.queryReportPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	link, err := a.db.GetSegmentReport(ctx.Request.Context(), ctx.Param("slug"), period)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Report generated successfully", "download_link": link})
+}
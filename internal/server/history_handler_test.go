@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestSegmentHistoryHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	august := models.ReportPeriod{From: from, To: from.AddDate(0, 1, 0), Location: time.UTC}
+
+	tests := []struct {
+		name         string
+		target       string
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:   "List Segment History",
+			target: "/api/v2/segments/AVITO_DISCOUNT_30/history?from=2023-08-01&to=2023-08-31&limit=2&cursor=abc",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegmentHistory(gomock.Any(), models.SegmentHistoryQuery{
+					Slug: "AVITO_DISCOUNT_30", Period: august, Limit: 2, Cursor: "abc",
+				}).Return(models.SegmentHistoryPage{
+					Events: []models.SegmentEvent{
+						{UserID: 4, Operation: "add", OperationDate: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC), Variant: "control"},
+						{UserID: 4, Operation: "expire", OperationDate: time.Date(2023, 8, 20, 3, 0, 0, 0, time.UTC), Variant: "control"},
+					},
+					NextCursor: "def",
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"events": []interface{}{
+					map[string]interface{}{"user_id": float64(4), "operation": "add", "operation_date": "2023-08-01T12:00:00Z", "variant": "control"},
+					map[string]interface{}{"user_id": float64(4), "operation": "expire", "operation_date": "2023-08-20T03:00:00Z", "variant": "control"},
+				},
+				"next_cursor": "def",
+			},
+		},
+		{
+			name:   "List Segment History Error (segment does not exist)",
+			target: "/api/v2/segments/UNKNOWN/history?from=2023-08-01&to=2023-08-31",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegmentHistory(gomock.Any(), gomock.Any()).
+					Return(models.SegmentHistoryPage{}, dbError(db.ErrNotFound, "segment with slug 'UNKNOWN' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{"code": "not_found", "error": "segment with slug 'UNKNOWN' does not exist"},
+		},
+		{
+			name:         "List Segment History Error (missing period)",
+			target:       "/api/v2/segments/AVITO_DISCOUNT_30/history?to=2023-08-31",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "from should be a date YYYY-MM-DD or a timestamp in RFC 3339 format"},
+		},
+		{
+			name:         "List Segment History Error (invalid limit)",
+			target:       "/api/v2/segments/AVITO_DISCOUNT_30/history?from=2023-08-01&to=2023-08-31&limit=0",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "limit should be between 1 and 1000"},
+		},
+		{
+			name:   "Daily Segment History",
+			target: "/api/v2/segments/AVITO_DISCOUNT_30/history/daily?from=2023-08-01&to=2023-08-02",
+			mockSetup: func() {
+				mockDB.EXPECT().GetSegmentDailyHistory(gomock.Any(), "AVITO_DISCOUNT_30",
+					models.ReportPeriod{From: from, To: from.AddDate(0, 0, 2), Location: time.UTC}).Return([]models.SegmentDay{
+					{Date: "2023-08-01", Joins: 10, Leaves: 2, Net: 8, Size: 108},
+					{Date: "2023-08-02", Joins: 0, Leaves: 3, Net: -3, Size: 105},
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"days": []interface{}{
+					map[string]interface{}{"date": "2023-08-01", "joins": float64(10), "leaves": float64(2), "net": float64(8), "size": float64(108)},
+					map[string]interface{}{"date": "2023-08-02", "joins": float64(0), "leaves": float64(3), "net": float64(-3), "size": float64(105)},
+				},
+			},
+		},
+		{
+			name:   "Daily Segment History (single day)",
+			target: "/api/v2/segments/AVITO_DISCOUNT_30/history/daily?from=2023-08-01&to=2023-08-01",
+			mockSetup: func() {
+				mockDB.EXPECT().GetSegmentDailyHistory(gomock.Any(), "AVITO_DISCOUNT_30",
+					models.ReportPeriod{From: from, To: from.AddDate(0, 0, 1), Location: time.UTC}).
+					Return([]models.SegmentDay{{Date: "2023-08-01", Size: 100}}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"days": []interface{}{
+					map[string]interface{}{"date": "2023-08-01", "joins": float64(0), "leaves": float64(0), "net": float64(0), "size": float64(100)},
+				},
+			},
+		},
+		{
+			name:         "Daily Segment History Error (to before from)",
+			target:       "/api/v2/segments/AVITO_DISCOUNT_30/history/daily?from=2023-08-31&to=2023-08-01",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "to should be later than from"},
+		},
+		{
+			name:         "Daily Segment History Error (period too long)",
+			target:       "/api/v2/segments/AVITO_DISCOUNT_30/history/daily?from=2023-01-01&to=2024-01-02",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "period should not exceed 366 days"},
+		},
+		{
+			name:   "Segment Report",
+			target: "/api/v2/segments/AVITO_DISCOUNT_30/report?month=2023-08",
+			mockSetup: func() {
+				mockDB.EXPECT().GetSegmentReport(gomock.Any(), "AVITO_DISCOUNT_30", august).
+					Return("segment_AVITO_DISCOUNT_30_report_2023-08.csv", nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message":       "Report generated successfully",
+				"download_link": "segment_AVITO_DISCOUNT_30_report_2023-08.csv",
+			},
+		},
+		{
+			name:         "Segment Report Error (invalid date)",
+			target:       "/api/v2/segments/AVITO_DISCOUNT_30/report?from=2023-08-01&to=2023-08",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "to should be a date YYYY-MM-DD or a timestamp in RFC 3339 format"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
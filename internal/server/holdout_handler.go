@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+)
+
+// setHoldoutHandler задает процент holdout глобально или для группы исключения
+func (a *App) setHoldoutHandler(ctx *gin.Context) {
+	var req models.Holdout
+
+	// Парсинг JSON-запроса в структуру "Holdout"
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Проверка допустимости значения поля "Percentage"
+	if req.Percentage < 0 || req.Percentage > 100 {
+		respondWithError(ctx, http.StatusBadRequest, "Percentage should be between 0 and 100")
+		return
+	}
+
+	removed, err := a.db.SetHoldout(ctx.Request.Context(), req.ExclusionGroup, req.Percentage)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Holdout updated successfully", "removed": removed})
+}
+
+// getHoldoutsHandler возвращает настроенные holdout
+func (a *App) getHoldoutsHandler(ctx *gin.Context) {
+	holdouts, err := a.db.GetHoldouts(ctx.Request.Context())
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"holdouts": holdouts})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestHoldoutHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		handler      gin.HandlerFunc
+		requestBody  interface{}
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:         "Set Holdout Success (global)",
+			handler:      a.setHoldoutHandler,
+			requestBody:  models.Holdout{Percentage: 5},
+			mockSetup:    func() { mockDB.EXPECT().SetHoldout(gomock.Any(), "", 5.0).Return(12, nil) },
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Holdout updated successfully",
+				"removed": float64(12),
+			},
+		},
+		{
+			name:         "Set Holdout Success (exclusion group)",
+			handler:      a.setHoldoutHandler,
+			requestBody:  models.Holdout{ExclusionGroup: "checkout", Percentage: 10},
+			mockSetup:    func() { mockDB.EXPECT().SetHoldout(gomock.Any(), "checkout", 10.0).Return(0, nil) },
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Holdout updated successfully",
+				"removed": float64(0),
+			},
+		},
+		{
+			name:         "Set Holdout Error (invalid percentage)",
+			handler:      a.setHoldoutHandler,
+			requestBody:  models.Holdout{Percentage: 150},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Percentage should be between 0 and 100",
+			},
+		},
+		{
+			name:    "Get Holdouts Success",
+			handler: a.getHoldoutsHandler,
+			mockSetup: func() {
+				mockDB.EXPECT().GetHoldouts(gomock.Any()).Return([]models.Holdout{
+					{ExclusionGroup: "", Percentage: 5},
+					{ExclusionGroup: "checkout", Percentage: 10},
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"holdouts": []interface{}{
+					map[string]interface{}{"exclusion_group": "", "percentage": float64(5)},
+					map[string]interface{}{"exclusion_group": "checkout", "percentage": float64(10)},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			requestData, _ := json.Marshal(tc.requestBody)
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(requestData))
+			w := httptest.NewRecorder()
+
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = r
+
+			tc.handler(ctx)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
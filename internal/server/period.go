@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+)
+
+// maxReportDays максимальная длина периода отчета в днях
+const maxReportDays = 366
+
+// reportLocation возвращает часовой пояс периодов отчетов
+func (a *App) reportLocation() *time.Location {
+	if a.location == nil {
+		return time.UTC
+	}
+	return a.location
+}
+
+// queryReportPeriod возвращает период отчета из параметров запроса ?month= или ?from= и ?to=;
+// при некорректном периоде отправляет ошибку
+func (a *App) queryReportPeriod(ctx *gin.Context) (models.ReportPeriod, bool) {
+	period, err := parseReportPeriod(ctx.Query("month"), ctx.Query("from"), ctx.Query("to"), a.reportLocation())
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return models.ReportPeriod{}, false
+	}
+
+	return period, true
+}
+
+// parseReportPeriod разбирает период отчета: месяц YYYY-MM или границы from и to. Границы задаются датой YYYY-MM-DD
+// (from – с начала дня, to – включая весь день) или моментом времени RFC 3339 (to не включается).
+// Месяцы и даты считаются в часовом поясе location.
+func parseReportPeriod(month, from, to string, location *time.Location) (models.ReportPeriod, error) {
+	period := models.ReportPeriod{Location: location}
+
+	switch {
+	case month != "" && (from != "" || to != ""):
+		return period, errors.New("month cannot be combined with from and to")
+	case month != "":
+		start, err := time.ParseInLocation("2006-01", month, location)
+		if err != nil {
+			return period, errors.New("month should be in format YYYY-MM")
+		}
+		period.From, period.To = start, start.AddDate(0, 1, 0)
+		return period, nil
+	case from == "" && to == "":
+		return period, errors.New("report period should be specified with month or from and to")
+	}
+
+	var err error
+	if period.From, err = parseReportTime("from", from, location, false); err != nil {
+		return period, err
+	}
+	if period.To, err = parseReportTime("to", to, location, true); err != nil {
+		return period, err
+	}
+
+	switch {
+	case !period.To.After(period.From):
+		return period, errors.New("to should be later than from")
+	case period.To.After(period.From.AddDate(0, 0, maxReportDays)):
+		return period, fmt.Errorf("period should not exceed %d days", maxReportDays)
+	}
+
+	return period, nil
+}
+
+// parseReportTime разбирает границу периода name; дата конца периода (end) переносится на начало следующего дня
+func parseReportTime(name, value string, location *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.ParseInLocation(time.DateOnly, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s should be a date YYYY-MM-DD or a timestamp in RFC 3339 format", name)
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date, nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/models"
+)
+
+func TestParseReportPeriod(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		name           string
+		month          string
+		from           string
+		to             string
+		location       *time.Location
+		expectedPeriod models.ReportPeriod
+		expectedError  string
+	}{
+		{
+			name:     "Month",
+			month:    "2023-08",
+			location: time.UTC,
+			expectedPeriod: models.ReportPeriod{
+				From: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), Location: time.UTC,
+			},
+		},
+		{
+			name:     "Month in time zone",
+			month:    "2023-12",
+			location: moscow,
+			expectedPeriod: models.ReportPeriod{
+				From: time.Date(2023, 12, 1, 0, 0, 0, 0, moscow), To: time.Date(2024, 1, 1, 0, 0, 0, 0, moscow), Location: moscow,
+			},
+		},
+		{
+			name:     "Dates include the last day",
+			from:     "2023-08-15",
+			to:       "2023-08-15",
+			location: moscow,
+			expectedPeriod: models.ReportPeriod{
+				From: time.Date(2023, 8, 15, 0, 0, 0, 0, moscow), To: time.Date(2023, 8, 16, 0, 0, 0, 0, moscow), Location: moscow,
+			},
+		},
+		{
+			name:     "Timestamps",
+			from:     "2023-08-15T10:00:00Z",
+			to:       "2023-08-15T15:30:00+03:00",
+			location: moscow,
+			expectedPeriod: models.ReportPeriod{
+				From: time.Date(2023, 8, 15, 10, 0, 0, 0, time.UTC), To: time.Date(2023, 8, 15, 15, 30, 0, 0, moscow),
+				Location: moscow,
+			},
+		},
+		{
+			name:          "Error (no period)",
+			location:      time.UTC,
+			expectedError: "report period should be specified with month or from and to",
+		},
+		{
+			name:          "Error (month with dates)",
+			month:         "2023-08",
+			from:          "2023-08-01",
+			location:      time.UTC,
+			expectedError: "month cannot be combined with from and to",
+		},
+		{
+			name:          "Error (invalid month)",
+			month:         "2023-13",
+			location:      time.UTC,
+			expectedError: "month should be in format YYYY-MM",
+		},
+		{
+			name:          "Error (missing to)",
+			from:          "2023-08-01",
+			location:      time.UTC,
+			expectedError: "to should be a date YYYY-MM-DD or a timestamp in RFC 3339 format",
+		},
+		{
+			name:          "Error (empty period)",
+			from:          "2023-08-15T10:00:00Z",
+			to:            "2023-08-15T13:00:00+03:00",
+			location:      time.UTC,
+			expectedError: "to should be later than from",
+		},
+		{
+			name:          "Error (period too long)",
+			from:          "2023-01-01",
+			to:            "2024-01-02",
+			location:      time.UTC,
+			expectedError: "period should not exceed 366 days",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+
+			period, err := parseReportPeriod(tc.month, tc.from, tc.to, tc.location)
+			if tc.expectedError != "" {
+				assertion.EqualError(err, tc.expectedError)
+				return
+			}
+
+			assertion.NoError(err)
+			assertion.True(tc.expectedPeriod.From.Equal(period.From), "from: %v", period.From)
+			assertion.True(tc.expectedPeriod.To.Equal(period.To), "to: %v", period.To)
+			assertion.Equal(tc.expectedPeriod.Location, period.Location)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+)
+
+// createReportJobHandler ставит в очередь задание на создание отчета по истории пользователя или сегмента за период.
+// Отчет создается в фоне; состояние задания и ссылка на файл возвращаются getReportJobHandler.
+func (a *App) createReportJobHandler(ctx *gin.Context) {
+	var req models.ReportJobRequest
+
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch req.Type {
+	case models.ReportUser:
+		if req.UserID <= 0 {
+			respondWithError(ctx, http.StatusBadRequest, "user_id is required for user report")
+			return
+		}
+	case models.ReportSegment:
+		if req.SegmentSlug == "" {
+			respondWithError(ctx, http.StatusBadRequest, "segment_slug is required for segment report")
+			return
+		}
+	default:
+		respondWithError(ctx, http.StatusBadRequest, "type should be either 'user' or 'segment'")
+		return
+	}
+
+	period, err := parseReportPeriod(req.Month, req.From, req.To, a.reportLocation())
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := a.db.CreateReportJob(ctx.Request.Context(), models.ReportJob{
+		Type:        req.Type,
+		UserID:      req.UserID,
+		SegmentSlug: req.SegmentSlug,
+		From:        period.From,
+		To:          period.To,
+		TimeZone:    period.Location.String(),
+	})
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.Header("Location", fmt.Sprintf("/api/v2/reports/%d", job.ID))
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// getReportJobHandler возвращает состояние задания на создание отчета с ID из пути запроса;
+// для выполненного задания – ссылку на файл отчета в хранилище отчетов
+func (a *App) getReportJobHandler(ctx *gin.Context) {
+	jobID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Report job ID should be an integer")
+		return
+	}
+
+	job, err := a.db.GetReportJob(ctx.Request.Context(), jobID)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestReportJobHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	from := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	startedAt := time.Date(2023, 9, 1, 10, 0, 5, 0, time.UTC)
+	finishedAt := time.Date(2023, 9, 1, 10, 3, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		requestBody      string
+		mockSetup        func()
+		expectedCode     int
+		expectedLocation string
+		expectedBody     map[string]interface{}
+	}{
+		{
+			name:        "Create Segment Report Job",
+			method:      http.MethodPost,
+			target:      "/api/v2/reports",
+			requestBody: `{"type": "segment", "segment_slug": "AVITO_DISCOUNT_30", "from": "2023-06-01", "to": "2023-08-31"}`,
+			mockSetup: func() {
+				mockDB.EXPECT().CreateReportJob(gomock.Any(), models.ReportJob{
+					Type: models.ReportSegment, SegmentSlug: "AVITO_DISCOUNT_30", From: from, To: to, TimeZone: "UTC",
+				}).Return(models.ReportJob{
+					ID: 7, Type: models.ReportSegment, SegmentSlug: "AVITO_DISCOUNT_30", From: from, To: to, TimeZone: "UTC",
+					Status: models.ReportQueued, CreatedAt: createdAt,
+				}, nil)
+			},
+			expectedCode:     http.StatusAccepted,
+			expectedLocation: "/api/v2/reports/7",
+			expectedBody: map[string]interface{}{
+				"id":           float64(7),
+				"type":         "segment",
+				"segment_slug": "AVITO_DISCOUNT_30",
+				"from":         "2023-06-01T00:00:00Z",
+				"to":           "2023-09-01T00:00:00Z",
+				"time_zone":    "UTC",
+				"status":       "queued",
+				"progress":     float64(0),
+				"rows_total":   float64(0),
+				"rows_written": float64(0),
+				"created_at":   "2023-09-01T10:00:00Z",
+			},
+		},
+		{
+			name:        "Create User Report Job Error (user does not exist)",
+			method:      http.MethodPost,
+			target:      "/api/v2/reports",
+			requestBody: `{"type": "user", "user_id": 13, "month": "2023-08"}`,
+			mockSetup: func() {
+				mockDB.EXPECT().CreateReportJob(gomock.Any(), gomock.Any()).
+					Return(models.ReportJob{}, dbError(db.ErrNotFound, "user with ID '13' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{"code": "not_found", "error": "user with ID '13' does not exist"},
+		},
+		{
+			name:         "Create Report Job Error (unknown type)",
+			method:       http.MethodPost,
+			target:       "/api/v2/reports",
+			requestBody:  `{"type": "holdout", "month": "2023-08"}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "type should be either 'user' or 'segment'"},
+		},
+		{
+			name:         "Create Report Job Error (missing segment)",
+			method:       http.MethodPost,
+			target:       "/api/v2/reports",
+			requestBody:  `{"type": "segment", "month": "2023-08"}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "segment_slug is required for segment report"},
+		},
+		{
+			name:         "Create Report Job Error (invalid period)",
+			method:       http.MethodPost,
+			target:       "/api/v2/reports",
+			requestBody:  `{"type": "user", "user_id": 3, "month": "2023-8-1"}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "month should be in format YYYY-MM"},
+		},
+		{
+			name:   "Get Running Report Job",
+			method: http.MethodGet,
+			target: "/api/v2/reports/7",
+			mockSetup: func() {
+				mockDB.EXPECT().GetReportJob(gomock.Any(), 7).Return(models.ReportJob{
+					ID: 7, Type: models.ReportUser, UserID: 3, From: from, To: to, TimeZone: "UTC",
+					Status: models.ReportRunning, Progress: 40, RowsTotal: 50000, RowsWritten: 20000,
+					CreatedAt: createdAt, StartedAt: &startedAt,
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"id":           float64(7),
+				"type":         "user",
+				"user_id":      float64(3),
+				"from":         "2023-06-01T00:00:00Z",
+				"to":           "2023-09-01T00:00:00Z",
+				"time_zone":    "UTC",
+				"status":       "running",
+				"progress":     float64(40),
+				"rows_total":   float64(50000),
+				"rows_written": float64(20000),
+				"created_at":   "2023-09-01T10:00:00Z",
+				"started_at":   "2023-09-01T10:00:05Z",
+			},
+		},
+		{
+			name:   "Get Done Report Job",
+			method: http.MethodGet,
+			target: "/api/v2/reports/7",
+			mockSetup: func() {
+				mockDB.EXPECT().GetReportJob(gomock.Any(), 7).Return(models.ReportJob{
+					ID: 7, Type: models.ReportUser, UserID: 3, From: from, To: to, TimeZone: "UTC",
+					Status: models.ReportDone, Progress: 100, RowsTotal: 50000, RowsWritten: 50000,
+					FileName:     "report_7_1_user_3_report_2023-06-01_2023-08-31.csv",
+					DownloadLink: "http://localhost:8080/user/report/report_7_1_user_3_report_2023-06-01_2023-08-31.csv",
+					CreatedAt:    createdAt, StartedAt: &startedAt, FinishedAt: &finishedAt,
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"id":            float64(7),
+				"type":          "user",
+				"user_id":       float64(3),
+				"from":          "2023-06-01T00:00:00Z",
+				"to":            "2023-09-01T00:00:00Z",
+				"time_zone":     "UTC",
+				"status":        "done",
+				"progress":      float64(100),
+				"rows_total":    float64(50000),
+				"rows_written":  float64(50000),
+				"download_link": "http://localhost:8080/user/report/report_7_1_user_3_report_2023-06-01_2023-08-31.csv",
+				"created_at":    "2023-09-01T10:00:00Z",
+				"started_at":    "2023-09-01T10:00:05Z",
+				"finished_at":   "2023-09-01T10:03:00Z",
+			},
+		},
+		{
+			name:   "Get Report Job Error (job does not exist)",
+			method: http.MethodGet,
+			target: "/api/v2/reports/8",
+			mockSetup: func() {
+				mockDB.EXPECT().GetReportJob(gomock.Any(), 8).
+					Return(models.ReportJob{}, dbError(db.ErrNotFound, "report job with ID '8' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{"code": "not_found", "error": "report job with ID '8' does not exist"},
+		},
+		{
+			name:         "Get Report Job Error (invalid ID)",
+			method:       http.MethodGet,
+			target:       "/api/v2/reports/latest",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{"code": "invalid_request", "error": "Report job ID should be an integer"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.requestBody))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+			assertion.Equal(tc.expectedLocation, w.Header().Get("Location"))
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
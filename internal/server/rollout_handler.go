@@ -0,0 +1,85 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+
+	"user-segmentation-service/internal/models"
+)
+
+// rolloutActions действия над планом раскатки и статусы, в которые они переводят план
+var rolloutActions = map[string]string{
+	"pause":  models.RolloutPaused,
+	"resume": models.RolloutActive,
+	"abort":  models.RolloutAborted,
+}
+
+// createRolloutHandler создает план постепенной раскатки сегмента
+func (a *App) createRolloutHandler(ctx *gin.Context) {
+	var req models.RolloutRequest
+
+	// Парсинг JSON-запроса в структуру "RolloutRequest"
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.Steps) == 0 {
+		respondWithError(ctx, http.StatusBadRequest, "Rollout should have at least one step")
+		return
+	}
+
+	// Проверка допустимости шагов
+	for _, step := range req.Steps {
+		if step.Percentage < 0 || step.Percentage > 100 {
+			respondWithError(ctx, http.StatusBadRequest, "Step percentage should be between 0 and 100")
+			return
+		}
+		if step.ApplyAt.IsZero() {
+			respondWithError(ctx, http.StatusBadRequest, "Step apply_at should not be zero")
+			return
+		}
+	}
+
+	// Шаги применяются в порядке наступления
+	sort.SliceStable(req.Steps, func(i, j int) bool {
+		return req.Steps[i].ApplyAt.Before(req.Steps[j].ApplyAt)
+	})
+
+	rollout, err := a.db.CreateRollout(ctx.Request.Context(), ctx.Param("slug"), req.Steps)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, rollout)
+}
+
+// getRolloutHandler возвращает состояние последнего плана раскатки сегмента
+func (a *App) getRolloutHandler(ctx *gin.Context) {
+	rollout, err := a.db.GetRollout(ctx.Request.Context(), ctx.Param("slug"))
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rollout)
+}
+
+// changeRolloutHandler приостанавливает (pause), возобновляет (resume) или прерывает (abort) план раскатки
+func (a *App) changeRolloutHandler(ctx *gin.Context) {
+	status, ok := rolloutActions[ctx.Param("action")]
+	if !ok {
+		respondWithError(ctx, http.StatusBadRequest, "Action should be one of 'pause', 'resume', 'abort'")
+		return
+	}
+
+	rollout, err := a.db.SetRolloutStatus(ctx.Request.Context(), ctx.Param("slug"), status)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rollout)
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestRolloutHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+
+	day1 := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	day3 := time.Date(2023, 9, 3, 10, 0, 0, 0, time.UTC)
+
+	rollout := models.Rollout{
+		ID:                1,
+		SegmentSlug:       "AVITO_SALE_30",
+		Status:            models.RolloutActive,
+		CurrentPercentage: 5,
+		CreatedAt:         day1,
+		UpdatedAt:         day1,
+		Steps: []models.RolloutStep{
+			{Percentage: 5, ApplyAt: day1, AppliedAt: &day1, Added: 50},
+			{Percentage: 25, ApplyAt: day3},
+		},
+	}
+	rolloutBody := map[string]interface{}{
+		"id":                 float64(1),
+		"segment_slug":       "AVITO_SALE_30",
+		"status":             "active",
+		"current_percentage": float64(5),
+		"created_at":         "2023-09-01T10:00:00Z",
+		"updated_at":         "2023-09-01T10:00:00Z",
+		"steps": []interface{}{
+			map[string]interface{}{
+				"percentage": float64(5),
+				"apply_at":   "2023-09-01T10:00:00Z",
+				"applied_at": "2023-09-01T10:00:00Z",
+				"added":      float64(50),
+				"removed":    float64(0),
+			},
+			map[string]interface{}{
+				"percentage": float64(25),
+				"apply_at":   "2023-09-03T10:00:00Z",
+				"added":      float64(0),
+				"removed":    float64(0),
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		handler      gin.HandlerFunc
+		params       gin.Params
+		requestBody  interface{}
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:    "Create Rollout Success (steps are sorted)",
+			handler: a.createRolloutHandler,
+			params:  gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			requestBody: models.RolloutRequest{
+				Steps: []models.RolloutStep{
+					{Percentage: 25, ApplyAt: day3},
+					{Percentage: 5, ApplyAt: day1},
+				},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateRollout(gomock.Any(), "AVITO_SALE_30", []models.RolloutStep{
+					{Percentage: 5, ApplyAt: day1},
+					{Percentage: 25, ApplyAt: day3},
+				}).Return(rollout, nil)
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: rolloutBody,
+		},
+		{
+			name:    "Create Rollout Error (invalid percentage)",
+			handler: a.createRolloutHandler,
+			params:  gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			requestBody: models.RolloutRequest{
+				Steps: []models.RolloutStep{{Percentage: 120, ApplyAt: day1}},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Step percentage should be between 0 and 100",
+			},
+		},
+		{
+			name:         "Create Rollout Error (no steps)",
+			handler:      a.createRolloutHandler,
+			params:       gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			requestBody:  models.RolloutRequest{},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Rollout should have at least one step",
+			},
+		},
+		{
+			name:    "Get Rollout Success",
+			handler: a.getRolloutHandler,
+			params:  gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			mockSetup: func() {
+				mockDB.EXPECT().GetRollout(gomock.Any(), "AVITO_SALE_30").Return(rollout, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: rolloutBody,
+		},
+		{
+			name:    "Get Rollout Error (no rollout)",
+			handler: a.getRolloutHandler,
+			params:  gin.Params{{Key: "slug", Value: "AVITO_SALE_10"}},
+			mockSetup: func() {
+				mockDB.EXPECT().GetRollout(gomock.Any(), "AVITO_SALE_10").Return(
+					models.Rollout{}, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_10' has no rollout"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_10' has no rollout",
+			},
+		},
+		{
+			name:    "Pause Rollout Success",
+			handler: a.changeRolloutHandler,
+			params:  gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}, {Key: "action", Value: "pause"}},
+			mockSetup: func() {
+				mockDB.EXPECT().SetRolloutStatus(gomock.Any(), "AVITO_SALE_30", models.RolloutPaused).Return(rollout, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: rolloutBody,
+		},
+		{
+			name:         "Change Rollout Error (unknown action)",
+			handler:      a.changeRolloutHandler,
+			params:       gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}, {Key: "action", Value: "restart"}},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Action should be one of 'pause', 'resume', 'abort'",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			requestData, _ := json.Marshal(tc.requestBody)
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(requestData))
+			w := httptest.NewRecorder()
+
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = r
+			ctx.Params = tc.params
+
+			tc.handler(ctx)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
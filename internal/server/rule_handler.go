@@ -0,0 +1,138 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/internal/rule"
+)
+
+// maxRuleSampleSize ограничивает выборку пользователей при пробном вычислении правила
+const maxRuleSampleSize = 1000
+
+// evaluateRuleHandler вычисляет правило для пользователя или случайной выборки пользователей,
+// не изменяя сегменты
+func (a *App) evaluateRuleHandler(ctx *gin.Context) {
+	var req models.EvaluateRuleRequest
+
+	// Парсинг JSON-запроса в структуру "EvaluateRuleRequest"
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if (req.UserId == nil) == (req.SampleSize == 0) {
+		respondWithError(ctx, http.StatusBadRequest, "Either user_id or sample_size should be specified")
+		return
+	}
+	if req.SampleSize < 0 || req.SampleSize > maxRuleSampleSize {
+		respondWithError(ctx, http.StatusBadRequest, "sample_size should be between 1 and 1000")
+		return
+	}
+
+	expr, err := rule.Parse(req.Rule)
+	if err != nil {
+		respondWithRuleError(ctx, "Invalid rule: "+err.Error(), err)
+		return
+	}
+
+	schema, err := a.db.GetAttributeSchema(ctx.Request.Context())
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+	if err := rule.Check(expr, schema); err != nil {
+		respondWithRuleError(ctx, "Invalid rule: "+err.Error(), err)
+		return
+	}
+
+	// Пробное вычисление для одного пользователя
+	if req.UserId != nil {
+		attributes, err := a.db.GetUserAttributes(ctx.Request.Context(), *req.UserId)
+		if err != nil {
+			respondWithDBError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, models.RuleEvaluation{UserId: *req.UserId, Matched: rule.Eval(expr, attributes)})
+		return
+	}
+
+	// Пробное вычисление для выборки пользователей
+	users, err := a.db.SampleUserAttributes(ctx.Request.Context(), req.SampleSize)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	matched := []int{}
+	for _, user := range users {
+		if rule.Eval(expr, user.Attributes) {
+			matched = append(matched, user.UserId)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"sampled": len(users), "matched": len(matched), "matched_user_ids": matched})
+}
+
+// getAttributesHandler возвращает схему атрибутов пользователей
+func (a *App) getAttributesHandler(ctx *gin.Context) {
+	schema, err := a.db.GetAttributeSchema(ctx.Request.Context())
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	attributes := make([]models.AttributeDefinition, 0, len(schema))
+	for name, attributeType := range schema {
+		attributes = append(attributes, models.AttributeDefinition{Name: name, Type: string(attributeType)})
+	}
+	slices.SortFunc(attributes, func(x, y models.AttributeDefinition) int { return cmp.Compare(x.Name, y.Name) })
+
+	ctx.JSON(http.StatusOK, gin.H{"attributes": attributes})
+}
+
+// declareAttributeHandler объявляет атрибут пользователей и его тип
+func (a *App) declareAttributeHandler(ctx *gin.Context) {
+	var req models.AttributeDefinition
+
+	// Парсинг JSON-запроса в структуру "AttributeDefinition"
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Name == "" {
+		respondWithError(ctx, http.StatusBadRequest, "Name should not be empty")
+		return
+	}
+
+	attributeType, err := rule.ParseType(req.Type)
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := a.db.SetAttributeType(ctx.Request.Context(), req.Name, attributeType); err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Attribute declared successfully"})
+}
+
+// respondWithRuleError отправляет ошибку 400 в тексте правила вместе с позицией ошибки
+func respondWithRuleError(ctx *gin.Context, message string, err error) {
+	var ruleErr *rule.Error
+	if !errors.As(err, &ruleErr) {
+		respondWithError(ctx, http.StatusBadRequest, message)
+		return
+	}
+
+	respondWithErrorBody(ctx, http.StatusBadRequest, gin.H{"error": message, "code": codeInvalidRequest, "position": ruleErr.Pos})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/internal/rule"
+	"user-segmentation-service/mocks"
+)
+
+func TestRuleHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+
+	schema := rule.Schema{"country": rule.TypeString, "age": rule.TypeNumber}
+	userID := 1
+
+	tests := []struct {
+		name         string
+		handler      gin.HandlerFunc
+		requestBody  interface{}
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:        "Evaluate Rule Success (user)",
+			handler:     a.evaluateRuleHandler,
+			requestBody: models.EvaluateRuleRequest{Rule: `country == "RU" and age >= 18`, UserId: &userID},
+			mockSetup: func() {
+				mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(schema, nil)
+				mockDB.EXPECT().GetUserAttributes(gomock.Any(), 1).Return(map[string]interface{}{"country": "RU", "age": 30.0}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"user_id": float64(1),
+				"matched": true,
+			},
+		},
+		{
+			name:        "Evaluate Rule Success (sample)",
+			handler:     a.evaluateRuleHandler,
+			requestBody: models.EvaluateRuleRequest{Rule: `country == "RU"`, SampleSize: 3},
+			mockSetup: func() {
+				mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(schema, nil)
+				mockDB.EXPECT().SampleUserAttributes(gomock.Any(), 3).Return([]models.UserAttributes{
+					{UserId: 1, Attributes: map[string]interface{}{"country": "RU"}},
+					{UserId: 2, Attributes: map[string]interface{}{"country": "KZ"}},
+					{UserId: 3, Attributes: map[string]interface{}{}},
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"sampled":          float64(3),
+				"matched":          float64(1),
+				"matched_user_ids": []interface{}{float64(1)},
+			},
+		},
+		{
+			name:         "Evaluate Rule Error (syntax)",
+			handler:      a.evaluateRuleHandler,
+			requestBody:  models.EvaluateRuleRequest{Rule: `country == `, UserId: &userID},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":     "invalid_request",
+				"error":    "Invalid rule: unexpected end of expression, expected attribute or value at position 12",
+				"position": float64(12),
+			},
+		},
+		{
+			name:        "Evaluate Rule Error (type mismatch)",
+			handler:     a.evaluateRuleHandler,
+			requestBody: models.EvaluateRuleRequest{Rule: `age == "18"`, UserId: &userID},
+			mockSetup: func() {
+				mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(schema, nil)
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":     "invalid_request",
+				"error":    "Invalid rule: right operand of == should be number, got string at position 8",
+				"position": float64(8),
+			},
+		},
+		{
+			name:         "Evaluate Rule Error (no target)",
+			handler:      a.evaluateRuleHandler,
+			requestBody:  models.EvaluateRuleRequest{Rule: `country == "RU"`},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Either user_id or sample_size should be specified",
+			},
+		},
+		{
+			name:        "Evaluate Rule Error (user does not exist)",
+			handler:     a.evaluateRuleHandler,
+			requestBody: models.EvaluateRuleRequest{Rule: `country == "RU"`, UserId: &userID},
+			mockSetup: func() {
+				mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(schema, nil)
+				mockDB.EXPECT().GetUserAttributes(gomock.Any(), 1).Return(nil, dbError(db.ErrNotFound, "user with ID '1' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "user with ID '1' does not exist",
+			},
+		},
+		{
+			name:         "Declare Attribute Success",
+			handler:      a.declareAttributeHandler,
+			requestBody:  models.AttributeDefinition{Name: "signup_date", Type: "date"},
+			mockSetup:    func() { mockDB.EXPECT().SetAttributeType(gomock.Any(), "signup_date", rule.TypeDate).Return(nil) },
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Attribute declared successfully",
+			},
+		},
+		{
+			name:         "Declare Attribute Error (unknown type)",
+			handler:      a.declareAttributeHandler,
+			requestBody:  models.AttributeDefinition{Name: "signup_date", Type: "timestamp"},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "unknown attribute type 'timestamp', expected one of string, number, bool, date",
+			},
+		},
+		{
+			name:         "Get Attributes Success",
+			handler:      a.getAttributesHandler,
+			mockSetup:    func() { mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(schema, nil) },
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"attributes": []interface{}{
+					map[string]interface{}{"name": "age", "type": "number"},
+					map[string]interface{}{"name": "country", "type": "string"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup()
+			}
+
+			requestData, _ := json.Marshal(tc.requestBody)
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(requestData))
+			w := httptest.NewRecorder()
+
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = r
+
+			tc.handler(ctx)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
+
+func TestEvaluateRuleRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	userID := 1
+
+	// Маршрут пробного вычисления не перекрывается маршрутами сегмента со slug в пути
+	for _, target := range []string{"/segment/evaluate", "/api/v2/segments/evaluate"} {
+		t.Run(target, func(t *testing.T) {
+			assertion := assert.New(t)
+
+			mockDB.EXPECT().GetAttributeSchema(gomock.Any()).Return(rule.Schema{"country": rule.TypeString}, nil)
+			mockDB.EXPECT().GetUserAttributes(gomock.Any(), 1).Return(map[string]interface{}{"country": "RU"}, nil)
+
+			requestData, _ := json.Marshal(models.EvaluateRuleRequest{Rule: `country == "RU"`, UserId: &userID})
+			r := httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(requestData))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(true, response["matched"])
+		})
+	}
+}
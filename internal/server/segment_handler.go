@@ -1,10 +1,15 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
+	"strconv"
 
 	"user-segmentation-service/internal/models"
+	"user-segmentation-service/internal/rule"
 )
 
 // createSegmentHandler создает сегмент и добавляет в него установленный % случайных пользователей
@@ -23,15 +28,255 @@ func (a *App) createSegmentHandler(ctx *gin.Context) {
 		return
 	}
 
-	err := a.db.CreateSegment(segment.Slug, segment.RandomPercentage, segment.ExpirationDate)
+	// Проверка способа выбора пользователей
+	if segment.Bucketing != "" && segment.Bucketing != models.BucketingRandom && segment.Bucketing != models.BucketingHash {
+		respondWithError(ctx, http.StatusBadRequest, "Bucketing should be either 'random' or 'hash'")
+		return
+	}
+
+	// Проверка правила: участники такого сегмента определяются только атрибутами пользователей
+	if segment.Rule != "" {
+		if segment.RandomPercentage > 0 {
+			respondWithError(ctx, http.StatusBadRequest, "Rule and RandomPercentage cannot be combined")
+			return
+		}
+		if _, err := rule.Parse(segment.Rule); err != nil {
+			respondWithRuleError(ctx, "Invalid rule: "+err.Error(), err)
+			return
+		}
+	}
+
+	// Проверка вариантов эксперимента
+	if err := validateVariants(segment.Variants); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid variants: "+err.Error())
+		return
+	}
+
+	// Проверка тегов
+	if err := validateTags(segment.Tags); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid tags: "+err.Error())
+		return
+	}
+
+	err := a.db.CreateSegment(ctx.Request.Context(), segment)
 	if err != nil {
-		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		respondWithDBError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Segment and user assignments created successfully"})
 }
 
+// updateSegmentHandler изменяет процент пользователей сегмента без перераспределения текущих участников
+// или правило сегмента с пересчетом его участников
+func (a *App) updateSegmentHandler(ctx *gin.Context) {
+	var req models.UpdateSegmentRequest
+
+	// Парсинг JSON-запроса в структуру "UpdateSegmentRequest"
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.RandomPercentage == nil && req.Rule == nil {
+		respondWithError(ctx, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+	if req.RandomPercentage != nil && req.Rule != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Rule and RandomPercentage cannot be combined")
+		return
+	}
+
+	// Проверка допустимости значения поля "RandomPercentage"
+	if req.RandomPercentage != nil && (*req.RandomPercentage < 0 || *req.RandomPercentage > 100) {
+		respondWithError(ctx, http.StatusBadRequest, "RandomPercentage should be between 0 and 100")
+		return
+	}
+
+	// Проверка правила; пустое правило превращает сегмент в обычный
+	if req.Rule != nil && *req.Rule != "" {
+		if _, err := rule.Parse(*req.Rule); err != nil {
+			respondWithRuleError(ctx, "Invalid rule: "+err.Error(), err)
+			return
+		}
+	}
+
+	changes, err := a.db.UpdateSegment(ctx.Request.Context(), ctx.Param("slug"), req)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Segment updated successfully", "added": changes.Added, "removed": changes.Removed})
+}
+
+// validateVariants проверяет, что у вариантов эксперимента уникальные непустые названия и положительные веса
+func validateVariants(variants []models.Variant) error {
+	if len(variants) == 1 {
+		return errors.New("at least 2 variants should be specified")
+	}
+
+	names := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if variant.Name == "" {
+			return errors.New("variant name should not be empty")
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("variant '%s' is specified more than once", variant.Name)
+		}
+		if variant.Weight <= 0 {
+			return fmt.Errorf("weight of variant '%s' should be positive", variant.Name)
+		}
+		names[variant.Name] = true
+	}
+
+	return nil
+}
+
+// validateTags проверяет, что теги сегмента непустые и не повторяются
+func validateTags(tags []string) error {
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.New("tag should not be empty")
+		}
+		if seen[tag] {
+			return fmt.Errorf("tag '%s' is specified more than once", tag)
+		}
+		seen[tag] = true
+	}
+
+	return nil
+}
+
+// getSegmentHandler возвращает сегмент со slug из пути запроса, количество его участников
+// и количество добавлений и удалений за последние 30 дней
+func (a *App) getSegmentHandler(ctx *gin.Context) {
+	segment, err := a.db.GetSegment(ctx.Request.Context(), ctx.Param("slug"))
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, segment)
+}
+
+// listSegmentsHandler возвращает страницу сегментов, отсортированных по slug, с фильтрами по префиксу slug (?slug=),
+// тегу (?tag=) и статусу (?status=active|rolling_out|expired) и курсором следующей страницы (?cursor=)
+func (a *App) listSegmentsHandler(ctx *gin.Context) {
+	query := models.SegmentsQuery{
+		SlugPrefix: ctx.Query("slug"),
+		Tag:        ctx.Query("tag"),
+		Status:     ctx.Query("status"),
+		Cursor:     ctx.Query("cursor"),
+	}
+
+	switch query.Status {
+	case "", models.SegmentActive, models.SegmentRollingOut, models.SegmentExpired:
+	default:
+		respondWithError(ctx, http.StatusBadRequest, "status should be one of active, rolling_out, expired")
+		return
+	}
+
+	var ok bool
+	if query.Limit, ok = pageLimit(ctx); !ok {
+		return
+	}
+
+	page, err := a.db.ListSegments(ctx.Request.Context(), query)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// segmentMembersHandler возвращает участников сегмента со slug из пути запроса: страницу JSON с курсором (?limit=, ?cursor=)
+// или, с параметром ?format=ndjson|csv, всех участников потоком. Даты истечения участия добавляются по ?include_expiration=true.
+func (a *App) segmentMembersHandler(ctx *gin.Context) {
+	includeExpiration := false
+	if value := ctx.Query("include_expiration"); value != "" {
+		var err error
+		if includeExpiration, err = strconv.ParseBool(value); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, "include_expiration should be a boolean")
+			return
+		}
+	}
+
+	switch format := ctx.Query("format"); format {
+	case "":
+	case formatNDJSON, formatCSV:
+		a.streamSegmentMembers(ctx, memberExport{format: format, includeExpiration: includeExpiration})
+		return
+	default:
+		respondWithError(ctx, http.StatusBadRequest, "format should be either 'ndjson' or 'csv'")
+		return
+	}
+
+	query := models.SegmentMembersQuery{Slug: ctx.Param("slug"), Cursor: ctx.Query("cursor")}
+
+	var ok bool
+	if query.Limit, ok = pageLimit(ctx); !ok {
+		return
+	}
+
+	page, err := a.db.ListSegmentMembers(ctx.Request.Context(), query)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	if !includeExpiration {
+		for i := range page.Users {
+			page.Users[i].ExpirationDate = nil
+		}
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// importSegmentUsersHandler добавляет в сегмент со slug из пути запроса пользователей из CSV файла (поле file
+// формы multipart/form-data). С параметром ?mode=replace участники, которых нет в файле, удаляются из сегмента.
+// Файл передается в базу данных по мере получения и не сохраняется целиком.
+func (a *App) importSegmentUsersHandler(ctx *gin.Context) {
+	mode := ctx.DefaultQuery("mode", models.ImportAppend)
+	if mode != models.ImportAppend && mode != models.ImportReplace {
+		respondWithError(ctx, http.StatusBadRequest, "mode should be either 'append' or 'replace'")
+		return
+	}
+
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Request should be multipart/form-data with a file")
+		return
+	}
+
+	// Поиск поля file; остальные поля формы пропускаются
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			respondWithError(ctx, http.StatusBadRequest, "file with user IDs is required")
+			return
+		} else if err != nil {
+			respondWithError(ctx, http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		result, err := a.db.ImportSegmentUsers(ctx.Request.Context(), ctx.Param("slug"), mode == models.ImportReplace, part)
+		if err != nil {
+			respondWithDBError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, result)
+		return
+	}
+}
+
 // deleteSegmentHandler обрабатывает удаление сегмента
 func (a *App) deleteSegmentHandler(ctx *gin.Context) {
 	var segment models.Segment
@@ -42,9 +287,19 @@ func (a *App) deleteSegmentHandler(ctx *gin.Context) {
 		return
 	}
 
-	segmentID, err := a.db.DeleteSegment(segment.Slug)
+	a.deleteSegment(ctx, segment.Slug)
+}
+
+// deleteSegmentV2Handler удаляет сегмент по slug из пути запроса
+func (a *App) deleteSegmentV2Handler(ctx *gin.Context) {
+	a.deleteSegment(ctx, ctx.Param("slug"))
+}
+
+// deleteSegment удаляет сегмент и отправляет ответ
+func (a *App) deleteSegment(ctx *gin.Context, slug string) {
+	segmentID, err := a.db.DeleteSegment(ctx.Request.Context(), slug)
 	if err != nil {
-		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		respondWithDBError(ctx, err)
 		return
 	}
 
@@ -2,8 +2,12 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +17,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"user-segmentation-service/internal/db"
 	"user-segmentation-service/internal/models"
 	"user-segmentation-service/mocks"
 )
@@ -29,6 +34,7 @@ func TestSegmentHandlers(t *testing.T) {
 	tests := []struct {
 		name         string
 		handler      gin.HandlerFunc
+		params       gin.Params
 		requestBody  interface{}
 		mockSetup    func()
 		expectedCode int
@@ -49,7 +55,7 @@ func TestSegmentHandlers(t *testing.T) {
 				RandomPercentage: 0.0,
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().CreateSegment("AVITO_SALE_10", gomock.Any(), gomock.Any()).Return(nil)
+				mockDB.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
@@ -73,9 +79,286 @@ func TestSegmentHandlers(t *testing.T) {
 			mockSetup:    func() {},
 			expectedCode: http.StatusBadRequest,
 			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
 				"error": "RandomPercentage should be between 0 and 100",
 			},
 		},
+		{
+			name:    "Create Segment Error (already exists)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_10",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(
+					dbError(db.ErrAlreadyExists, "segment with slug 'AVITO_SALE_10' already exists"))
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: map[string]interface{}{
+				"code":  "already_exists",
+				"error": "segment with slug 'AVITO_SALE_10' already exists",
+			},
+		},
+		{
+			name:    "Create Segment Error (database unavailable)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_10",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(
+					errors.New("failed to begin transaction: dial tcp 127.0.0.1:5432: connect: connection refused"))
+			},
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: map[string]interface{}{
+				"code":  "internal",
+				"error": "Internal server error",
+			},
+		},
+		{
+			name:    "Create Segment Error (timeout)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_10",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(
+					fmt.Errorf("failed to add users to segment: %w", context.DeadlineExceeded))
+			},
+			expectedCode: http.StatusGatewayTimeout,
+			expectedBody: map[string]interface{}{
+				"code":  "timeout",
+				"error": "failed to add users to segment: context deadline exceeded",
+			},
+		},
+		{
+			name:    "Create Segment Success (hash bucketing)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:             "AVITO_SALE_30",
+				ExpirationDate:   time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				RandomPercentage: 30.0,
+				Bucketing:        models.BucketingHash,
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), models.Segment{
+					Slug:             "AVITO_SALE_30",
+					ExpirationDate:   time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+					RandomPercentage: 30.0,
+					Bucketing:        models.BucketingHash,
+				}).Return(nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment and user assignments created successfully",
+			},
+		},
+		{
+			name:    "Create Segment Success (variants)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:             "CHECKOUT_EXP",
+				ExpirationDate:   time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				RandomPercentage: 20.0,
+				Bucketing:        models.BucketingHash,
+				Variants:         []models.Variant{{Name: "control", Weight: 50}, {Name: "treatment_a", Weight: 25}, {Name: "treatment_b", Weight: 25}},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), models.Segment{
+					Slug:             "CHECKOUT_EXP",
+					ExpirationDate:   time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+					RandomPercentage: 20.0,
+					Bucketing:        models.BucketingHash,
+					Variants:         []models.Variant{{Name: "control", Weight: 50}, {Name: "treatment_a", Weight: 25}, {Name: "treatment_b", Weight: 25}},
+				}).Return(nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment and user assignments created successfully",
+			},
+		},
+		{
+			name:    "Create Segment Error (duplicate variant)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "CHECKOUT_EXP",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Variants:       []models.Variant{{Name: "control", Weight: 50}, {Name: "control", Weight: 50}},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Invalid variants: variant 'control' is specified more than once",
+			},
+		},
+		{
+			name:    "Create Segment Error (non-positive weight)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "CHECKOUT_EXP",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Variants:       []models.Variant{{Name: "control", Weight: 100}, {Name: "treatment", Weight: 0}},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Invalid variants: weight of variant 'treatment' should be positive",
+			},
+		},
+		{
+			name:    "Create Segment Success (tags)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_10",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Tags:           []string{"sale", "marketing"},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), models.Segment{
+					Slug:           "AVITO_SALE_10",
+					ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+					Tags:           []string{"sale", "marketing"},
+				}).Return(nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment and user assignments created successfully",
+			},
+		},
+		{
+			name:    "Create Segment Error (duplicate tag)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_10",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Tags:           []string{"sale", "sale"},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Invalid tags: tag 'sale' is specified more than once",
+			},
+		},
+		{
+			name:    "Create Segment Error (unknown bucketing)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_SALE_30",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Bucketing:      "round_robin",
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Bucketing should be either 'random' or 'hash'",
+			},
+		},
+		{
+			name:        "Update Segment Success",
+			handler:     a.updateSegmentHandler,
+			params:      gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			requestBody: map[string]interface{}{"random_percentage": 50.0},
+			mockSetup: func() {
+				percentage := 50.0
+				mockDB.EXPECT().UpdateSegment(gomock.Any(), "AVITO_SALE_30", models.UpdateSegmentRequest{
+					RandomPercentage: &percentage,
+				}).Return(models.MembershipChanges{Added: 40}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment updated successfully",
+				"added":   float64(40),
+				"removed": float64(0),
+			},
+		},
+		{
+			name:         "Update Segment Error (invalid percentage)",
+			handler:      a.updateSegmentHandler,
+			params:       gin.Params{{Key: "slug", Value: "AVITO_SALE_30"}},
+			requestBody:  map[string]interface{}{"random_percentage": -5.0},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "RandomPercentage should be between 0 and 100",
+			},
+		},
+		{
+			name:        "Update Segment Error (segment does not exist)",
+			handler:     a.updateSegmentHandler,
+			params:      gin.Params{{Key: "slug", Value: "AVITO_SALE_666"}},
+			requestBody: map[string]interface{}{"random_percentage": 10.0},
+			mockSetup: func() {
+				mockDB.EXPECT().UpdateSegment(gomock.Any(), "AVITO_SALE_666", gomock.Any()).Return(
+					models.MembershipChanges{}, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_666' does not exist",
+			},
+		},
+		{
+			name:    "Create Segment Success (rule)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_PRO_RU",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Rule:           `country in ["RU", "KZ"] and plan == "pro"`,
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateSegment(gomock.Any(), models.Segment{
+					Slug:           "AVITO_PRO_RU",
+					ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+					Rule:           `country in ["RU", "KZ"] and plan == "pro"`,
+				}).Return(nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment and user assignments created successfully",
+			},
+		},
+		{
+			name:    "Create Segment Error (invalid rule)",
+			handler: a.createSegmentHandler,
+			requestBody: models.Segment{
+				Slug:           "AVITO_PRO_RU",
+				ExpirationDate: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Rule:           `country in ["RU", "KZ"`,
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":     "invalid_request",
+				"error":    `Invalid rule: unexpected end of expression, expected "," or "]" at position 23`,
+				"position": float64(23),
+			},
+		},
+		{
+			name:        "Update Segment Success (rule)",
+			handler:     a.updateSegmentHandler,
+			params:      gin.Params{{Key: "slug", Value: "AVITO_PRO_RU"}},
+			requestBody: map[string]interface{}{"rule": `plan == "pro"`},
+			mockSetup: func() {
+				rule := `plan == "pro"`
+				mockDB.EXPECT().UpdateSegment(gomock.Any(), "AVITO_PRO_RU", models.UpdateSegmentRequest{
+					Rule: &rule,
+				}).Return(models.MembershipChanges{Added: 3, Removed: 1}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "Segment updated successfully",
+				"added":   float64(3),
+				"removed": float64(1),
+			},
+		},
 		{
 			name:    "Delete Segment Success",
 			handler: a.deleteSegmentHandler,
@@ -83,7 +366,7 @@ func TestSegmentHandlers(t *testing.T) {
 				Slug: "AVITO_SALE_10",
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().DeleteSegment("AVITO_SALE_10").Return(1, nil)
+				mockDB.EXPECT().DeleteSegment(gomock.Any(), "AVITO_SALE_10").Return(1, nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
@@ -98,12 +381,13 @@ func TestSegmentHandlers(t *testing.T) {
 				Slug: "AVITO_SALE_666",
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().DeleteSegment(
+				mockDB.EXPECT().DeleteSegment(gomock.Any(),
 					"AVITO_SALE_666").Return(
-					0, errors.New("segment with slug 'AVITO_SALE_666' does not exist"))
+					0, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "segment with slug 'AVITO_SALE_666' does not exist",
 			},
 		},
@@ -122,6 +406,7 @@ func TestSegmentHandlers(t *testing.T) {
 
 			ctx, _ := gin.CreateTestContext(w)
 			ctx.Request = r
+			ctx.Params = tc.params
 
 			tc.handler(ctx)
 
@@ -134,3 +419,144 @@ func TestSegmentHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestImportSegmentUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	const file = "user_id,expiration_date\n1,2023-12-31\n2\n"
+
+	// expectFile проверяет, что в базу данных передано содержимое поля file
+	expectFile := func(result models.ImportResult, err error) func(context.Context, string, bool, io.Reader) (models.ImportResult, error) {
+		return func(_ context.Context, _ string, _ bool, r io.Reader) (models.ImportResult, error) {
+			content, _ := io.ReadAll(r)
+			assert.Equal(t, file, string(content))
+			return result, err
+		}
+	}
+
+	tests := []struct {
+		name         string
+		target       string
+		multipart    bool
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:      "Import Success",
+			target:    "/api/v2/segments/AVITO_SALE_10/import",
+			multipart: true,
+			mockSetup: func() {
+				mockDB.EXPECT().ImportSegmentUsers(gomock.Any(), "AVITO_SALE_10", false, gomock.Any()).DoAndReturn(expectFile(models.ImportResult{
+					Rows: 2, Added: 1, Rejected: 1,
+					Rejections: []models.ImportRejection{{Line: 3, UserID: 2, Error: "user does not exist"}},
+				}, nil))
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"rows":       float64(2),
+				"added":      float64(1),
+				"duplicates": float64(0),
+				"rejected":   float64(1),
+				"removed":    float64(0),
+				"rejections": []interface{}{
+					map[string]interface{}{"line": float64(3), "user_id": float64(2), "error": "user does not exist"},
+				},
+			},
+		},
+		{
+			name:      "Import Success (replace)",
+			target:    "/api/v2/segments/AVITO_SALE_10/import?mode=replace",
+			multipart: true,
+			mockSetup: func() {
+				mockDB.EXPECT().ImportSegmentUsers(gomock.Any(), "AVITO_SALE_10", true, gomock.Any()).DoAndReturn(expectFile(models.ImportResult{
+					Rows: 2, Added: 1, Duplicates: 1, Removed: 5, Rejections: []models.ImportRejection{},
+				}, nil))
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"rows":       float64(2),
+				"added":      float64(1),
+				"duplicates": float64(1),
+				"rejected":   float64(0),
+				"removed":    float64(5),
+				"rejections": []interface{}{},
+			},
+		},
+		{
+			name:      "Import Error (segment does not exist)",
+			target:    "/api/v2/segments/AVITO_SALE_666/import",
+			multipart: true,
+			mockSetup: func() {
+				mockDB.EXPECT().ImportSegmentUsers(gomock.Any(), "AVITO_SALE_666", false, gomock.Any()).Return(
+					models.ImportResult{}, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_666' does not exist",
+			},
+		},
+		{
+			name:         "Import Error (invalid mode)",
+			target:       "/api/v2/segments/AVITO_SALE_10/import?mode=merge",
+			multipart:    true,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "mode should be either 'append' or 'replace'",
+			},
+		},
+		{
+			name:         "Import Error (not multipart)",
+			target:       "/api/v2/segments/AVITO_SALE_10/import",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Request should be multipart/form-data with a file",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			var body bytes.Buffer
+			contentType := "text/csv"
+			if tc.multipart {
+				form := multipart.NewWriter(&body)
+				_ = form.WriteField("comment", "target list")
+				part, _ := form.CreateFormFile("file", "users.csv")
+				_, _ = part.Write([]byte(file))
+				_ = form.Close()
+				contentType = form.FormDataContentType()
+			} else {
+				body.WriteString(file)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, tc.target, &body)
+			r.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
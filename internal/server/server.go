@@ -1,31 +1,43 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"user-segmentation-service/config"
 	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/rule"
 )
 
 // App структура для приложения
 type App struct {
-	db db.InterfaceDB
+	db            db.InterfaceDB
+	batchGetLimit int            // максимальное количество пользователей в запросе сегментов нескольких пользователей
+	location      *time.Location // часовой пояс периодов отчетов; nil – UTC
+	reportDir     string         // каталог отчетов, раздаваемых сервисом; пусто – отчеты хранятся вне сервиса
 }
 
 // NewApp создаёт новый экземпляр приложения
-func NewApp(db db.InterfaceDB) *App {
-	return &App{db: db}
+func NewApp(db db.InterfaceDB, batchGetLimit int, location *time.Location, reportDir string) *App {
+	return &App{db: db, batchGetLimit: batchGetLimit, location: location, reportDir: reportDir}
 }
 
-// Run запускает приложение
-func (a *App) Run(cfg *config.Config) *http.Server {
+// Run запускает приложение. Контексты запросов наследуются от ctx, поэтому его отмена
+// прерывает незавершенные запросы вместе с их операциями с базой данных.
+func (a *App) Run(ctx context.Context, cfg *config.Config) *http.Server {
 	r := a.setupRouter() // Настройка маршрутизации
 
 	srv := &http.Server{
-		Addr:    cfg.HTTP.Port,
-		Handler: r,
+		Addr:        cfg.HTTP.Port,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
@@ -43,20 +55,147 @@ func (a *App) setupRouter() *gin.Engine {
 	r := gin.Default()
 	// Определение обработчиков маршрутов
 	r.POST("/user", a.createUserHandler)
+	r.POST("/user/bulk", a.createUsersHandler)
+	r.PATCH("/user", a.updateUserAttributesHandler)
 	r.DELETE("/user", a.deleteUserHandler)
 	r.POST("/segment", a.createSegmentHandler)
+	r.PATCH("/segment/:slug", a.updateSegmentHandler)
 	r.DELETE("/segment", a.deleteSegmentHandler)
+	r.POST("/segment/:slug/rollout", a.createRolloutHandler)
+	r.GET("/segment/:slug/rollout", a.getRolloutHandler)
+	r.POST("/segment/:slug/rollout/:action", a.changeRolloutHandler)
+	r.POST("/segment/evaluate", a.evaluateRuleHandler)
+	r.GET("/attribute", a.getAttributesHandler)
+	r.POST("/attribute", a.declareAttributeHandler)
+	r.GET("/holdout", a.getHoldoutsHandler)
+	r.POST("/holdout", a.setHoldoutHandler)
 	r.POST("/user/segments", a.updateUserSegmentsHandler)
 	r.GET("/user/segments", a.getUserSegmentsHandler)
 	r.GET("/user/report", a.getUserReportHandler)
-	r.Static("/user/report", "reports")
+	if a.reportDir != "" {
+		r.Static("/user/report", a.reportDir)
+	}
+
+	// REST API: идентификаторы ресурсов передаются в пути, GET и DELETE не требуют тела запроса
+	v2 := r.Group("/api/v2")
+	v2.GET("/users", a.listUsersHandler)
+	v2.POST("/users", a.createUserHandler)
+	v2.GET("/users/:id", a.getUserHandler)
+	v2.POST("/users/:id", a.userCollectionMethodHandler)
+	v2.DELETE("/users/:id", a.deleteUserV2Handler)
+	v2.GET("/users/:id/segments", a.getUserSegmentsV2Handler)
+	v2.POST("/users/:id/segments", a.updateUserSegmentsV2Handler)
+	v2.GET("/users/:id/report", a.getUserReportV2Handler)
+	v2.GET("/segments", a.listSegmentsHandler)
+	v2.POST("/segments", a.createSegmentHandler)
+	v2.POST("/segments/evaluate", a.evaluateRuleHandler)
+	v2.GET("/segments/:slug", a.getSegmentHandler)
+	v2.GET("/segments/:slug/users", a.segmentMembersHandler)
+	v2.GET("/segments/:slug/export", a.exportSegmentHandler)
+	v2.GET("/segments/:slug/history", a.segmentHistoryHandler)
+	v2.GET("/segments/:slug/history/daily", a.segmentDailyHistoryHandler)
+	v2.GET("/segments/:slug/report", a.segmentReportHandler)
+	v2.POST("/segments/:slug/import", a.importSegmentUsersHandler)
+	v2.PATCH("/segments/:slug", a.updateSegmentHandler)
+	v2.DELETE("/segments/:slug", a.deleteSegmentV2Handler)
+	v2.POST("/segments/:slug/rollout", a.createRolloutHandler)
+	v2.GET("/segments/:slug/rollout", a.getRolloutHandler)
+	v2.POST("/segments/:slug/rollout/:action", a.changeRolloutHandler)
+	v2.POST("/reports", a.createReportJobHandler)
+	v2.GET("/reports/:id", a.getReportJobHandler)
 
 	return r
 }
 
-// respondWithError отправляет ошибку клиенту
+// Коды ошибок в ответе (поле "code")
+const (
+	codeInvalidRequest = "invalid_request"
+	codeNotFound       = "not_found"
+	codeAlreadyExists  = "already_exists"
+	codeConflict       = "conflict"
+	codeTimeout        = "timeout"
+	codeInternal       = "internal"
+)
+
+// respondWithError отправляет ошибку клиенту; код ошибки определяется по статусу ответа
 func respondWithError(ctx *gin.Context, status int, message string) {
-	ctx.JSON(status, gin.H{"error": message}) // Отправка JSON ответа с кодом ошибки и сообщением
-	ctx.Abort()                               // Прекращение обработки текущего запроса
-	//log.Println(ctx.Request.RequestURI, status, message)
+	respondWithErrorBody(ctx, status, gin.H{"error": message, "code": errorCode(status)})
+}
+
+// respondWithDBError отправляет ошибку, полученную от базы данных, со статусом по виду ошибки.
+// Сообщения внутренних ошибок не передаются клиенту, а записываются в лог.
+func respondWithDBError(ctx *gin.Context, err error) {
+	var status int
+	var code string
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		status, code = http.StatusNotFound, codeNotFound
+	case errors.Is(err, db.ErrAlreadyExists):
+		status, code = http.StatusConflict, codeAlreadyExists
+	case errors.Is(err, db.ErrConflict):
+		status, code = http.StatusConflict, codeConflict
+	case errors.Is(err, db.ErrValidation):
+		status, code = http.StatusBadRequest, codeInvalidRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, codeTimeout
+	default:
+		log.Println(ctx.Request.Method, ctx.Request.URL.Path, err)
+		respondWithError(ctx, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	body := gin.H{"error": err.Error(), "code": code}
+
+	// Для ошибки в правиле сегмента добавляется позиция в тексте правила
+	var ruleErr *rule.Error
+	if errors.As(err, &ruleErr) {
+		body["position"] = ruleErr.Pos
+	}
+
+	respondWithErrorBody(ctx, status, body)
+}
+
+// respondWithErrorBody отправляет JSON ответ с ошибкой и прекращает обработку текущего запроса
+func respondWithErrorBody(ctx *gin.Context, status int, body gin.H) {
+	ctx.JSON(status, body)
+	ctx.Abort()
+}
+
+// errorCode возвращает код ошибки для статуса ответа
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidRequest
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusGatewayTimeout:
+		return codeTimeout
+	case http.StatusInternalServerError:
+		return codeInternal
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// Размер страницы списков
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// pageLimit возвращает размер страницы из параметра limit; при некорректном значении отправляет ошибку.
+func pageLimit(ctx *gin.Context) (int, bool) {
+	value := ctx.Query("limit")
+	if value == "" {
+		return defaultPageLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("limit should be between 1 and %d", maxPageLimit))
+		return 0, false
+	}
+
+	return limit, true
 }
@@ -0,0 +1,642 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestRouterV2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB, batchGetLimit: 3}
+
+	gin.SetMode(gin.TestMode)
+	router := a.setupRouter()
+
+	expirationDate := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		requestBody  string
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:   "Get User",
+			method: http.MethodGet,
+			target: "/api/v2/users/5",
+			mockSetup: func() {
+				mockDB.EXPECT().GetUser(gomock.Any(), 5).Return(models.UserDetails{
+					ID: 5, Name: "Maks", Attributes: map[string]interface{}{"country": "RU"}, SegmentCount: 3,
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"id":            float64(5),
+				"name":          "Maks",
+				"attributes":    map[string]interface{}{"country": "RU"},
+				"segment_count": float64(3),
+			},
+		},
+		{
+			name:   "Get User Error (user does not exist)",
+			method: http.MethodGet,
+			target: "/api/v2/users/13",
+			mockSetup: func() {
+				mockDB.EXPECT().GetUser(gomock.Any(), 13).Return(models.UserDetails{}, dbError(db.ErrNotFound, "user with ID '13' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "user with ID '13' does not exist",
+			},
+		},
+		{
+			name:   "List Users",
+			method: http.MethodGet,
+			target: "/api/v2/users?name=Ma&sort=-name&limit=2&cursor=eyJzIjoiLW5hbWUiLCJpIjo5fQ",
+			mockSetup: func() {
+				mockDB.EXPECT().ListUsers(gomock.Any(), models.UsersQuery{
+					NamePrefix: "Ma", Sort: "-name", Limit: 2, Cursor: "eyJzIjoiLW5hbWUiLCJpIjo5fQ",
+				}).Return(models.UsersPage{
+					Users: []models.UserDetails{
+						{ID: 7, Name: "Maxim", SegmentCount: 0},
+						{ID: 2, Name: "Maks", SegmentCount: 4},
+					},
+					NextCursor: "eyJzIjoiLW5hbWUiLCJpIjoyLCJuIjoiTWFrcyJ9",
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"id": float64(7), "name": "Maxim", "segment_count": float64(0)},
+					map[string]interface{}{"id": float64(2), "name": "Maks", "segment_count": float64(4)},
+				},
+				"next_cursor": "eyJzIjoiLW5hbWUiLCJpIjoyLCJuIjoiTWFrcyJ9",
+			},
+		},
+		{
+			name:   "List Users (defaults)",
+			method: http.MethodGet,
+			target: "/api/v2/users",
+			mockSetup: func() {
+				mockDB.EXPECT().ListUsers(gomock.Any(), models.UsersQuery{Sort: "id", Limit: 50}).Return(
+					models.UsersPage{Users: []models.UserDetails{}}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users": []interface{}{},
+			},
+		},
+		{
+			name:         "List Users Error (invalid limit)",
+			method:       http.MethodGet,
+			target:       "/api/v2/users?limit=0",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "limit should be between 1 and 1000",
+			},
+		},
+		{
+			name:         "List Users Error (invalid sort)",
+			method:       http.MethodGet,
+			target:       "/api/v2/users?sort=created_at",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "sort should be one of id, -id, name, -name",
+			},
+		},
+		{
+			name:   "List Users Error (invalid cursor)",
+			method: http.MethodGet,
+			target: "/api/v2/users?cursor=garbage",
+			mockSetup: func() {
+				mockDB.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(models.UsersPage{}, dbError(db.ErrValidation, "invalid cursor"))
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "invalid cursor",
+			},
+		},
+		{
+			name:   "Get User Segments",
+			method: http.MethodGet,
+			target: "/api/v2/users/1/segments",
+			mockSetup: func() {
+				mockDB.EXPECT().GetUserSegments(gomock.Any(), 1, false).Return(1, []models.UserSegment{}, nil)
+				mockDB.EXPECT().GetUserHoldouts(gomock.Any(), 1).Return([]string{}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"user_id":  float64(1),
+				"segments": []interface{}{},
+				"holdout":  false,
+			},
+		},
+		{
+			name:         "Get User Segments Error (invalid user ID)",
+			method:       http.MethodGet,
+			target:       "/api/v2/users/abc/segments",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "User ID should be an integer",
+			},
+		},
+		{
+			name:         "Get User Segments Error (user ID out of range)",
+			method:       http.MethodGet,
+			target:       "/api/v2/users/3000000000/segments",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "User ID should be between 1 and 2147483647",
+			},
+		},
+		{
+			name:        "Update User Segments",
+			method:      http.MethodPost,
+			target:      "/api/v2/users/7/segments",
+			requestBody: `{"add": [{"slug": "AVITO_SALE_10"}], "remove": ["AVITO_SALE_20"]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().UpdateUserSegments(gomock.Any(), 7, []models.Segment{{Slug: "AVITO_SALE_10"}}, []string{"AVITO_SALE_20"}).Return(7, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "User segments updated successfully",
+				"user_id": float64(7),
+			},
+		},
+		{
+			name:        "Batch Get User Segments",
+			method:      http.MethodPost,
+			target:      "/api/v2/users/segments:batchGet",
+			requestBody: `{"user_ids": [1, 2, 99]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().GetUsersSegments(gomock.Any(), []int{1, 2, 99}, false).Return(
+					map[int][]models.UserSegment{
+						1: {{Slug: "AVITO_SALE_10", AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC), Variant: "control"}},
+						2: {},
+					},
+					[]int{99}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users": map[string]interface{}{
+					"1": []interface{}{
+						map[string]interface{}{
+							"slug":            "AVITO_SALE_10",
+							"added_at":        "2023-08-01T12:00:00Z",
+							"expiration_date": nil,
+							"variant":         "control",
+						},
+					},
+					"2": []interface{}{},
+				},
+				"unknown_user_ids": []interface{}{float64(99)},
+			},
+		},
+		{
+			name:        "Batch Get User Segments (IDs out of range)",
+			method:      http.MethodPost,
+			target:      "/api/v2/users/segments:batchGet",
+			requestBody: `{"user_ids": [3000000000, 2, -3000000000]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().GetUsersSegments(gomock.Any(), []int{2}, false).Return(
+					map[int][]models.UserSegment{2: {}}, []int{}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users":            map[string]interface{}{"2": []interface{}{}},
+				"unknown_user_ids": []interface{}{float64(-3000000000), float64(3000000000)},
+			},
+		},
+		{
+			name:         "Batch Get User Segments (only IDs out of range)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchGet",
+			requestBody:  `{"user_ids": [0, 0]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users":            map[string]interface{}{},
+				"unknown_user_ids": []interface{}{float64(0)},
+			},
+		},
+		{
+			name:         "Batch Get User Segments Error (too many IDs)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchGet",
+			requestBody:  `{"user_ids": [1, 2, 3, 4]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "user_ids should contain at most 3 IDs",
+			},
+		},
+		{
+			name:         "Batch Get User Segments Error (empty IDs)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchGet",
+			requestBody:  `{"user_ids": []}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "user_ids should not be empty",
+			},
+		},
+		{
+			name:         "Batch Get User Segments Error (unknown method)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchDelete",
+			requestBody:  `{"user_ids": [1]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "Unknown method",
+			},
+		},
+		{
+			name:        "Batch Update User Segments",
+			method:      http.MethodPost,
+			target:      "/api/v2/users/segments:batchUpdate",
+			requestBody: `{"user_ids": [1, 2, 3, 99], "add": [{"slug": "CHECKOUT_EXP"}], "remove": ["AVITO_SALE_10"]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().BulkUpdateUserSegments(gomock.Any(), []int{1, 2, 3, 99},
+					[]models.Segment{{Slug: "CHECKOUT_EXP"}}, []string{"AVITO_SALE_10"}).Return(models.BulkUpdateResult{
+					Users:        4,
+					Added:        2,
+					Removed:      1,
+					FailureCount: 2,
+					Failures: []models.BulkFailure{
+						{UserID: 99, Error: "user does not exist"},
+						{UserID: 3, Segment: "CHECKOUT_EXP", Error: "user is in holdout"},
+					},
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users":         float64(4),
+				"added":         float64(2),
+				"removed":       float64(1),
+				"failure_count": float64(2),
+				"failures": []interface{}{
+					map[string]interface{}{"user_id": float64(99), "error": "user does not exist"},
+					map[string]interface{}{"user_id": float64(3), "segment": "CHECKOUT_EXP", "error": "user is in holdout"},
+				},
+			},
+		},
+		{
+			name:         "Batch Update User Segments Error (nothing to update)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchUpdate",
+			requestBody:  `{"user_ids": [1, 2]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Nothing to update",
+			},
+		},
+		{
+			name:         "Batch Update User Segments Error (segment in both lists)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchUpdate",
+			requestBody:  `{"user_ids": [1, 2], "add": [{"slug": "AVITO_SALE_10"}], "remove": ["AVITO_SALE_10"]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Segment 'AVITO_SALE_10' cannot be both added and removed",
+			},
+		},
+		{
+			name:         "Batch Update User Segments Error (user ID out of range)",
+			method:       http.MethodPost,
+			target:       "/api/v2/users/segments:batchUpdate",
+			requestBody:  `{"user_ids": [1, -2], "remove": ["AVITO_SALE_10"]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "user_ids should contain IDs between 1 and 2147483647, got -2",
+			},
+		},
+		{
+			name:        "Batch Update User Segments Error (rule-based segment)",
+			method:      http.MethodPost,
+			target:      "/api/v2/users/segments:batchUpdate",
+			requestBody: `{"user_ids": [1, 2], "add": [{"slug": "AVITO_PRO_RU"}]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().BulkUpdateUserSegments(gomock.Any(), []int{1, 2}, []models.Segment{{Slug: "AVITO_PRO_RU"}}, nil).Return(
+					models.BulkUpdateResult{}, dbError(db.ErrConflict, "segment with slug 'AVITO_PRO_RU' is rule-based and cannot be assigned manually"))
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: map[string]interface{}{
+				"code":  "conflict",
+				"error": "segment with slug 'AVITO_PRO_RU' is rule-based and cannot be assigned manually",
+			},
+		},
+		{
+			name:   "Delete User",
+			method: http.MethodDelete,
+			target: "/api/v2/users/3",
+			mockSetup: func() {
+				mockDB.EXPECT().DeleteUser(gomock.Any(), 3).Return(3, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "User deleted successfully",
+				"user_id": float64(3),
+			},
+		},
+		{
+			name:   "Get User Report",
+			method: http.MethodGet,
+			target: "/api/v2/users/3/report?month=2023-08",
+			mockSetup: func() {
+				mockDB.EXPECT().GetUserReport(gomock.Any(), 3, models.ReportPeriod{
+					From: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), Location: time.UTC,
+				}).Return("user_3_report_2023-08.csv", nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message":       "Report generated successfully",
+				"download_link": "user_3_report_2023-08.csv",
+			},
+		},
+		{
+			name:   "Get User Report (date range)",
+			method: http.MethodGet,
+			target: "/api/v2/users/3/report?from=2023-07-15&to=2023-08-14",
+			mockSetup: func() {
+				mockDB.EXPECT().GetUserReport(gomock.Any(), 3, models.ReportPeriod{
+					From: time.Date(2023, 7, 15, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 8, 15, 0, 0, 0, 0, time.UTC), Location: time.UTC,
+				}).Return("user_3_report_2023-07-15_2023-08-14.csv", nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message":       "Report generated successfully",
+				"download_link": "user_3_report_2023-07-15_2023-08-14.csv",
+			},
+		},
+		{
+			name:         "Get User Report Error (invalid month)",
+			method:       http.MethodGet,
+			target:       "/api/v2/users/3/report?month=08-2023",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "month should be in format YYYY-MM",
+			},
+		},
+		{
+			name:   "List Segments",
+			method: http.MethodGet,
+			target: "/api/v2/segments?slug=AVITO&tag=sale&status=active&limit=1",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegments(gomock.Any(), models.SegmentsQuery{
+					SlugPrefix: "AVITO", Tag: "sale", Status: models.SegmentActive, Limit: 1,
+				}).Return(models.SegmentsPage{
+					Segments: []models.SegmentSummary{{
+						Slug:             "AVITO_SALE_10",
+						CreatedAt:        time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC),
+						ExpirationDate:   time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+						RandomPercentage: 10,
+						Bucketing:        models.BucketingHash,
+						Tags:             []string{"sale"},
+						Status:           models.SegmentActive,
+						MemberCount:      120,
+					}},
+					NextCursor: "eyJzIjoiQVZJVE9fU0FMRV8xMCJ9",
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"segments": []interface{}{
+					map[string]interface{}{
+						"slug":              "AVITO_SALE_10",
+						"created_at":        "2023-08-01T12:00:00Z",
+						"expiration_date":   "2023-12-31T00:00:00Z",
+						"random_percentage": float64(10),
+						"bucketing":         "hash",
+						"tags":              []interface{}{"sale"},
+						"status":            "active",
+						"member_count":      float64(120),
+					},
+				},
+				"next_cursor": "eyJzIjoiQVZJVE9fU0FMRV8xMCJ9",
+			},
+		},
+		{
+			name:         "List Segments Error (invalid status)",
+			method:       http.MethodGet,
+			target:       "/api/v2/segments?status=archived",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "status should be one of active, rolling_out, expired",
+			},
+		},
+		{
+			name:   "Get Segment",
+			method: http.MethodGet,
+			target: "/api/v2/segments/CHECKOUT_EXP",
+			mockSetup: func() {
+				mockDB.EXPECT().GetSegment(gomock.Any(), "CHECKOUT_EXP").Return(models.SegmentDetails{
+					SegmentSummary: models.SegmentSummary{
+						Slug:             "CHECKOUT_EXP",
+						CreatedAt:        time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC),
+						ExpirationDate:   time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+						RandomPercentage: 20,
+						Bucketing:        models.BucketingHash,
+						ExclusionGroup:   "checkout",
+						Tags:             []string{},
+						Status:           models.SegmentRollingOut,
+						MemberCount:      40,
+					},
+					Variants:          []models.Variant{{Name: "control", Weight: 50}, {Name: "treatment", Weight: 50}},
+					AddedLast30Days:   45,
+					RemovedLast30Days: 5,
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"slug":              "CHECKOUT_EXP",
+				"created_at":        "2023-08-01T12:00:00Z",
+				"expiration_date":   "2023-12-31T00:00:00Z",
+				"random_percentage": float64(20),
+				"bucketing":         "hash",
+				"exclusion_group":   "checkout",
+				"tags":              []interface{}{},
+				"status":            "rolling_out",
+				"member_count":      float64(40),
+				"variants": []interface{}{
+					map[string]interface{}{"name": "control", "weight": float64(50)},
+					map[string]interface{}{"name": "treatment", "weight": float64(50)},
+				},
+				"added_last_30_days":   float64(45),
+				"removed_last_30_days": float64(5),
+			},
+		},
+		{
+			name:   "Get Segment Error (segment does not exist)",
+			method: http.MethodGet,
+			target: "/api/v2/segments/AVITO_SALE_666",
+			mockSetup: func() {
+				mockDB.EXPECT().GetSegment(gomock.Any(), "AVITO_SALE_666").Return(models.SegmentDetails{}, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_666' does not exist",
+			},
+		},
+		{
+			name:   "List Segment Members",
+			method: http.MethodGet,
+			target: "/api/v2/segments/CHECKOUT_EXP/users?limit=2&cursor=eyJ1IjozfQ",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegmentMembers(gomock.Any(), models.SegmentMembersQuery{
+					Slug: "CHECKOUT_EXP", Limit: 2, Cursor: "eyJ1IjozfQ",
+				}).Return(models.SegmentMembersPage{
+					Users: []models.SegmentMember{
+						{UserID: 4, Name: "Maks", AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC), ExpirationDate: &expirationDate, Variant: "control"},
+						{UserID: 9, Name: "Maxim", AddedAt: time.Date(2023, 8, 2, 12, 0, 0, 0, time.UTC), Variant: "treatment"},
+					},
+					NextCursor: "eyJ1Ijo5fQ",
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"user_id": float64(4), "name": "Maks", "added_at": "2023-08-01T12:00:00Z", "variant": "control"},
+					map[string]interface{}{"user_id": float64(9), "name": "Maxim", "added_at": "2023-08-02T12:00:00Z", "variant": "treatment"},
+				},
+				"next_cursor": "eyJ1Ijo5fQ",
+			},
+		},
+		{
+			name:   "List Segment Members (include expiration)",
+			method: http.MethodGet,
+			target: "/api/v2/segments/AVITO_SALE_10/users?include_expiration=true",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegmentMembers(gomock.Any(), models.SegmentMembersQuery{Slug: "AVITO_SALE_10", Limit: 50}).Return(
+					models.SegmentMembersPage{Users: []models.SegmentMember{
+						{UserID: 4, Name: "Maks", AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC), ExpirationDate: &expirationDate},
+					}}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"user_id": float64(4), "name": "Maks", "added_at": "2023-08-01T12:00:00Z", "expiration_date": "2023-12-31T00:00:00Z"},
+				},
+			},
+		},
+		{
+			name:   "List Segment Members Error (segment does not exist)",
+			method: http.MethodGet,
+			target: "/api/v2/segments/AVITO_SALE_666/users",
+			mockSetup: func() {
+				mockDB.EXPECT().ListSegmentMembers(gomock.Any(), gomock.Any()).Return(models.SegmentMembersPage{},
+					dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_666' does not exist",
+			},
+		},
+		{
+			name:         "List Segment Members Error (invalid format)",
+			method:       http.MethodGet,
+			target:       "/api/v2/segments/AVITO_SALE_10/users?format=xml",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "format should be either 'ndjson' or 'csv'",
+			},
+		},
+		{
+			name:   "Delete Segment",
+			method: http.MethodDelete,
+			target: "/api/v2/segments/AVITO_SALE_10",
+			mockSetup: func() {
+				mockDB.EXPECT().DeleteSegment(gomock.Any(), "AVITO_SALE_10").Return(5, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message":    "Segment deleted successfully",
+				"segment_id": float64(5),
+			},
+		},
+		{
+			name:   "Delete Segment Error (segment does not exist)",
+			method: http.MethodDelete,
+			target: "/api/v2/segments/AVITO_SALE_666",
+			mockSetup: func() {
+				mockDB.EXPECT().DeleteSegment(gomock.Any(), "AVITO_SALE_666").Return(0, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_666' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "segment with slug 'AVITO_SALE_666' does not exist",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.requestBody))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
+
+// dbError создает ошибку базы данных заданного вида, как ее возвращает пакет db
+func dbError(kind error, message string) error {
+	return &db.Error{Kind: kind, Err: errors.New(message)}
+}
@@ -1,9 +1,17 @@
 package server
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"io"
+	"math"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"user-segmentation-service/internal/models"
 )
@@ -18,15 +26,126 @@ func (a *App) createUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	userID, err := a.db.CreateUser(user.Name)
+	if err := validateAttributes(user.Attributes); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, err := a.db.CreateUser(ctx.Request.Context(), user)
 	if err != nil {
-		respondWithError(ctx, http.StatusInternalServerError, "Failed to create user")
+		respondWithDBError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "user_id": userID})
 }
 
+// createUsersHandler создает пользователей списком (например, при импорте из внешней базы).
+func (a *App) createUsersHandler(ctx *gin.Context) {
+	var req models.CreateUsersRequest
+
+	// Пробуем привязать JSON к структуре CreateUsersRequest.
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.Users) == 0 {
+		respondWithError(ctx, http.StatusBadRequest, "Users list should not be empty")
+		return
+	}
+
+	for _, user := range req.Users {
+		if err := validateAttributes(user.Attributes); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	userIDs, err := a.db.CreateUsers(ctx.Request.Context(), req.Users)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Users created successfully", "user_ids": userIDs})
+}
+
+// updateUserAttributesHandler обновляет атрибуты пользователя и его участие в сегментах с правилами.
+func (a *App) updateUserAttributesHandler(ctx *gin.Context) {
+	var req models.UpdateUserAttributesRequest
+
+	// Привязываем входящий JSON к структуре UpdateUserAttributesRequest.
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateAttributes(req.Attributes); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	changes, err := a.db.UpdateUserAttributes(ctx.Request.Context(), req.UserId, req.Attributes)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "User attributes updated successfully",
+		"user_id": req.UserId,
+		"added":   changes.Added,
+		"removed": changes.Removed,
+	})
+}
+
+// getUserHandler возвращает пользователя с ID из пути запроса и количество его сегментов.
+func (a *App) getUserHandler(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := a.db.GetUser(ctx.Request.Context(), userID)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// listUsersHandler возвращает страницу пользователей с поиском по префиксу имени (?name=),
+// сортировкой (?sort=id|-id|name|-name) и курсором следующей страницы (?cursor=).
+func (a *App) listUsersHandler(ctx *gin.Context) {
+	query := models.UsersQuery{
+		NamePrefix: ctx.Query("name"),
+		Sort:       ctx.DefaultQuery("sort", models.UserSortID),
+		Cursor:     ctx.Query("cursor"),
+	}
+
+	switch strings.TrimPrefix(query.Sort, "-") {
+	case models.UserSortID, models.UserSortName:
+	default:
+		respondWithError(ctx, http.StatusBadRequest, "sort should be one of id, -id, name, -name")
+		return
+	}
+
+	var ok bool
+	if query.Limit, ok = pageLimit(ctx); !ok {
+		return
+	}
+
+	page, err := a.db.ListUsers(ctx.Request.Context(), query)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
 // deleteUserHandler удаляет пользователя по ID, полученному из JSON.
 func (a *App) deleteUserHandler(ctx *gin.Context) {
 	var req models.DeleteUserRequest
@@ -37,9 +156,24 @@ func (a *App) deleteUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	userID, err := a.db.DeleteUser(req.UserId)
+	a.deleteUser(ctx, req.UserId)
+}
+
+// deleteUserV2Handler удаляет пользователя по ID из пути запроса.
+func (a *App) deleteUserV2Handler(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	a.deleteUser(ctx, userID)
+}
+
+// deleteUser удаляет пользователя и отправляет ответ.
+func (a *App) deleteUser(ctx *gin.Context, userID int) {
+	userID, err := a.db.DeleteUser(ctx.Request.Context(), userID)
 	if err != nil {
-		respondWithError(ctx, http.StatusNotFound, err.Error())
+		respondWithDBError(ctx, err)
 		return
 	}
 
@@ -56,15 +190,56 @@ func (a *App) updateUserSegmentsHandler(ctx *gin.Context) {
 		return
 	}
 
-	userID, err := a.db.UpdateUserSegments(req.UserId, req.Add, req.Remove)
-	if err != nil {
+	a.updateUserSegments(ctx, req)
+}
+
+// updateUserSegmentsV2Handler обновляет сегменты пользователя с ID из пути запроса.
+func (a *App) updateUserSegmentsV2Handler(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateSegmentsRequest
+
+	// Привязываем входящий JSON к структуре UpdateSegmentsRequest; ID пользователя берется из пути.
+	if err := ctx.BindJSON(&req); err != nil {
 		respondWithError(ctx, http.StatusBadRequest, err.Error())
 		return
 	}
+	req.UserId = userID
+
+	a.updateUserSegments(ctx, req)
+}
+
+// updateUserSegments обновляет сегменты пользователя и отправляет ответ.
+// Сегмент не может быть одновременно в списках add и remove: сегменты из remove удаляются до добавления,
+// и результат такого запроса зависел бы от порядка операций, поэтому запрос отклоняется.
+func (a *App) updateUserSegments(ctx *gin.Context, req models.UpdateSegmentsRequest) {
+	if slug, ok := overlappingSegment(req.Add, req.Remove); ok {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("Segment '%s' cannot be both added and removed", slug))
+		return
+	}
+
+	userID, err := a.db.UpdateUserSegments(ctx.Request.Context(), req.UserId, req.Add, req.Remove)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "User segments updated successfully", "user_id": userID})
 }
 
+// overlappingSegment возвращает первый сегмент из addList, который есть и в removeList.
+func overlappingSegment(addList []models.Segment, removeList []string) (string, bool) {
+	for _, segment := range addList {
+		if slices.Contains(removeList, segment.Slug) {
+			return segment.Slug, true
+		}
+	}
+	return "", false
+}
+
 // getUserSegmentsHandler возвращает сегменты пользователя.
 func (a *App) getUserSegmentsHandler(ctx *gin.Context) {
 	var req models.UserSegmentsRequest
@@ -75,13 +250,232 @@ func (a *App) getUserSegmentsHandler(ctx *gin.Context) {
 		return
 	}
 
-	userID, segments, err := a.db.GetUserSegments(req.UserId)
+	a.getUserSegments(ctx, req.UserId)
+}
+
+// getUserSegmentsV2Handler возвращает сегменты пользователя с ID из пути запроса.
+func (a *App) getUserSegmentsV2Handler(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	a.getUserSegments(ctx, userID)
+}
+
+// getUserSegments отправляет сегменты пользователя и его участие в holdout.
+func (a *App) getUserSegments(ctx *gin.Context, userID int) {
+	// Просроченные сегменты возвращаются только по явному запросу (?include_expired=true), например для отладки
+	includeExpired := false
+	if value := ctx.Query("include_expired"); value != "" {
+		var err error
+		if includeExpired, err = strconv.ParseBool(value); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, "include_expired should be a boolean")
+			return
+		}
+	}
+
+	userID, segments, err := a.db.GetUserSegments(ctx.Request.Context(), userID, includeExpired)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	// Группы исключения, в holdout которых входит пользователь; пустая строка означает глобальный holdout
+	holdoutGroups, err := a.db.GetUserHoldouts(ctx.Request.Context(), userID)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	response := gin.H{"user_id": userID, "segments": segments, "holdout": false}
+	if len(holdoutGroups) > 0 && holdoutGroups[0] == "" {
+		response["holdout"] = true
+		holdoutGroups = holdoutGroups[1:]
+	}
+	if len(holdoutGroups) > 0 {
+		response["holdout_groups"] = holdoutGroups
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Методы коллекции пользователей
+const (
+	batchGetUserSegmentsMethod    = "segments:batchGet"    // получение сегментов нескольких пользователей
+	batchUpdateUserSegmentsMethod = "segments:batchUpdate" // массовое изменение сегментов пользователей
+)
+
+// maxBulkUserIDs ограничивает количество пользователей в одном запросе массового изменения сегментов
+const maxBulkUserIDs = 1000000
+
+// userCollectionMethodHandler обрабатывает методы коллекции пользователей вида POST /users/{collection}:{method}.
+// Маршрутизатор не различает "/users/segments:batchGet" и "/users/:id", поэтому метод определяется по значению параметра.
+func (a *App) userCollectionMethodHandler(ctx *gin.Context) {
+	switch ctx.Param("id") {
+	case batchGetUserSegmentsMethod:
+		a.batchGetUserSegmentsHandler(ctx)
+	case batchUpdateUserSegmentsMethod:
+		a.batchUpdateUserSegmentsHandler(ctx)
+	default:
+		respondWithError(ctx, http.StatusNotFound, "Unknown method")
+	}
+}
+
+// batchGetUserSegmentsHandler возвращает сегменты нескольких пользователей одним запросом к базе данных.
+// Отсутствующие пользователи возвращаются в unknown_user_ids и не приводят к ошибке.
+func (a *App) batchGetUserSegmentsHandler(ctx *gin.Context) {
+	var req models.BatchGetUserSegmentsRequest
+
+	// Привязываем входящий JSON к структуре BatchGetUserSegmentsRequest.
+	if err := ctx.BindJSON(&req); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.UserIds) == 0 {
+		respondWithError(ctx, http.StatusBadRequest, "user_ids should not be empty")
+		return
+	}
+	if len(req.UserIds) > a.batchGetLimit {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("user_ids should contain at most %d IDs", a.batchGetLimit))
+		return
+	}
+
+	// ID вне диапазона INTEGER не могут принадлежать пользователям: они не передаются в базу данных,
+	// а сразу перечисляются среди отсутствующих
+	userIDs := make([]int, 0, len(req.UserIds))
+	var invalid []int
+	for _, userID := range req.UserIds {
+		if validUserID(userID) {
+			userIDs = append(userIDs, userID)
+		} else {
+			invalid = append(invalid, userID)
+		}
+	}
+
+	segments := map[int][]models.UserSegment{}
+	unknown := []int{}
+	if len(userIDs) > 0 {
+		var err error
+		segments, unknown, err = a.db.GetUsersSegments(ctx.Request.Context(), userIDs, req.IncludeExpired)
+		if err != nil {
+			respondWithDBError(ctx, err)
+			return
+		}
+	}
+	if len(invalid) > 0 {
+		unknown = append(unknown, invalid...)
+		slices.Sort(unknown)
+		unknown = slices.Compact(unknown)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"users": segments, "unknown_user_ids": unknown})
+}
+
+// batchUpdateUserSegmentsHandler добавляет пользователей в сегменты и удаляет их из сегментов частями в отдельных транзакциях.
+// ID пользователей передаются в JSON (user_ids) или файлом: multipart/form-data с полем file (по одному ID в строке,
+// для CSV берется первая колонка) и полем segments с JSON {"add": [...], "remove": [...]}.
+func (a *App) batchUpdateUserSegmentsHandler(ctx *gin.Context) {
+	var req models.BulkUpdateUserSegmentsRequest
+
+	// Привязываем входящий JSON или форму с файлом к структуре BulkUpdateUserSegmentsRequest.
+	var err error
+	if ctx.ContentType() == gin.MIMEMultipartPOSTForm {
+		err = bindBulkUpdateForm(ctx, &req)
+	} else {
+		err = ctx.BindJSON(&req)
+	}
 	if err != nil {
 		respondWithError(ctx, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"user_id": userID, "segments": segments})
+	if len(req.UserIds) == 0 {
+		respondWithError(ctx, http.StatusBadRequest, "user_ids should not be empty")
+		return
+	}
+	if len(req.UserIds) > maxBulkUserIDs {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("user_ids should contain at most %d IDs", maxBulkUserIDs))
+		return
+	}
+	// ID вне диапазона INTEGER отклоняются до изменений: в базе данных они прервали бы обработку на середине
+	for _, userID := range req.UserIds {
+		if !validUserID(userID) {
+			respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("user_ids should contain IDs between 1 and %d, got %d", math.MaxInt32, userID))
+			return
+		}
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		respondWithError(ctx, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+	// Как и для одного пользователя, сегмент в обоих списках был бы удален и добавлен заново каждому пользователю
+	if slug, ok := overlappingSegment(req.Add, req.Remove); ok {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("Segment '%s' cannot be both added and removed", slug))
+		return
+	}
+
+	result, err := a.db.BulkUpdateUserSegments(ctx.Request.Context(), req.UserIds, req.Add, req.Remove)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// bindBulkUpdateForm читает запрос массового изменения сегментов из multipart/form-data
+func bindBulkUpdateForm(ctx *gin.Context, req *models.BulkUpdateUserSegmentsRequest) error {
+	if err := json.Unmarshal([]byte(ctx.PostForm("segments")), req); err != nil {
+		return fmt.Errorf("segments should be a JSON object with add and remove lists: %w", err)
+	}
+
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return errors.New("file with user IDs is required")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file with user IDs: %w", err)
+	}
+	defer file.Close()
+
+	req.UserIds, err = readUserIDs(file)
+	return err
+}
+
+// readUserIDs читает ID пользователей по одному в строке; из строк CSV берется первая колонка.
+// Первая строка, не являющаяся числом, считается заголовком, пустые строки пропускаются.
+func readUserIDs(r io.Reader) ([]int, error) {
+	var userIDs []int
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		field, _, _ := strings.Cut(scanner.Text(), ",")
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		userID, err := strconv.Atoi(field)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: user ID should be an integer, got '%s'", line, field)
+		}
+		if !validUserID(userID) {
+			return nil, fmt.Errorf("line %d: user ID should be between 1 and %d, got '%s'", line, math.MaxInt32, field)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file with user IDs: %w", err)
+	}
+
+	return userIDs, nil
 }
 
 // getUserReportHandler создает CSV отчет по истории сегментов пользователя.
@@ -93,12 +487,71 @@ func (a *App) getUserReportHandler(ctx *gin.Context) {
 		respondWithError(ctx, http.StatusBadRequest, err.Error())
 		return
 	}
-	fileName, err := a.db.GetUserReport(req.UserId, req.YearMonth)
+
+	period, err := parseReportPeriod(req.YearMonth, req.From, req.To, a.reportLocation())
 	if err != nil {
 		respondWithError(ctx, http.StatusBadRequest, err.Error())
 		return
 	}
-	reportHost := os.Getenv("HTTP_REPORT_HOST")
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Report generated successfully", "download_link": reportHost + fileName})
+	a.getUserReport(ctx, req.UserId, period)
+}
+
+// getUserReportV2Handler создает CSV отчет по истории сегментов пользователя с ID из пути запроса
+// за месяц (?month=YYYY-MM) или период (?from= и ?to=, см. parseReportPeriod).
+func (a *App) getUserReportV2Handler(ctx *gin.Context) {
+	userID, ok := userIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	period, ok := a.queryReportPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	a.getUserReport(ctx, userID, period)
+}
+
+// getUserReport создает CSV отчет и отправляет ссылку на него.
+func (a *App) getUserReport(ctx *gin.Context, userID int, period models.ReportPeriod) {
+	link, err := a.db.GetUserReport(ctx.Request.Context(), userID, period)
+	if err != nil {
+		respondWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Report generated successfully", "download_link": link})
+}
+
+// userIDParam возвращает ID пользователя из пути запроса; при некорректном ID отправляет ошибку.
+func userIDParam(ctx *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "User ID should be an integer")
+		return 0, false
+	}
+	if !validUserID(userID) {
+		respondWithError(ctx, http.StatusBadRequest, fmt.Sprintf("User ID should be between 1 and %d", math.MaxInt32))
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// validUserID проверяет, что ID пользователя – положительное INTEGER; другие значения база данных не принимает.
+func validUserID(userID int) bool {
+	return userID >= 1 && userID <= math.MaxInt32
+}
+
+// validateAttributes проверяет, что значения атрибутов – строки, числа, логические значения или null (удаление атрибута).
+func validateAttributes(attributes map[string]interface{}) error {
+	for name, value := range attributes {
+		switch value.(type) {
+		case string, float64, bool, nil:
+		default:
+			return fmt.Errorf("attribute '%s' should be a string, number, boolean or null", name)
+		}
+	}
+	return nil
 }
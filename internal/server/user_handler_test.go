@@ -3,7 +3,8 @@ package server
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"user-segmentation-service/internal/db"
 	"user-segmentation-service/internal/models"
 	"user-segmentation-service/mocks"
 )
@@ -26,9 +28,14 @@ func TestUserHandlers(t *testing.T) {
 
 	gin.SetMode(gin.TestMode)
 
+	august := models.ReportPeriod{
+		From: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), Location: time.UTC,
+	}
+
 	tests := []struct {
 		name         string
 		handler      gin.HandlerFunc
+		target       string
 		requestBody  interface{}
 		mockSetup    func()
 		expectedCode int
@@ -41,7 +48,7 @@ func TestUserHandlers(t *testing.T) {
 				Name: "John",
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().CreateUser("John").Return(int64(1), nil)
+				mockDB.EXPECT().CreateUser(gomock.Any(), models.User{Name: "John"}).Return(int64(1), nil)
 			},
 			expectedCode: http.StatusCreated,
 			expectedBody: map[string]interface{}{
@@ -49,6 +56,103 @@ func TestUserHandlers(t *testing.T) {
 				"user_id": float64(1),
 			},
 		},
+		{
+			name:    "Create User Success (with attributes)",
+			handler: a.createUserHandler,
+			requestBody: models.User{
+				Name:       "John",
+				Attributes: map[string]interface{}{"country": "RU", "plan": "pro", "age": 30.0},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateUser(gomock.Any(), models.User{
+					Name:       "John",
+					Attributes: map[string]interface{}{"country": "RU", "plan": "pro", "age": 30.0},
+				}).Return(int64(2), nil)
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"message": "User created successfully",
+				"user_id": float64(2),
+			},
+		},
+		{
+			name:    "Create User Error (nested attribute)",
+			handler: a.createUserHandler,
+			requestBody: models.User{
+				Name:       "John",
+				Attributes: map[string]interface{}{"address": map[string]interface{}{"city": "Moscow"}},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "attribute 'address' should be a string, number, boolean or null",
+			},
+		},
+		{
+			name:    "Update User Attributes Success",
+			handler: a.updateUserAttributesHandler,
+			requestBody: models.UpdateUserAttributesRequest{
+				UserId:     1,
+				Attributes: map[string]interface{}{"plan": "pro", "trial": nil},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().UpdateUserAttributes(gomock.Any(), 1, map[string]interface{}{"plan": "pro", "trial": nil}).Return(
+					models.MembershipChanges{Added: 1, Removed: 2}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"message": "User attributes updated successfully",
+				"user_id": float64(1),
+				"added":   float64(1),
+				"removed": float64(2),
+			},
+		},
+		{
+			name:    "Update User Attributes Error (user does not exist)",
+			handler: a.updateUserAttributesHandler,
+			requestBody: models.UpdateUserAttributesRequest{
+				UserId:     13,
+				Attributes: map[string]interface{}{"plan": "pro"},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().UpdateUserAttributes(gomock.Any(), 13, gomock.Any()).Return(
+					models.MembershipChanges{}, dbError(db.ErrNotFound, "user with ID '13' does not exist"))
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"code":  "not_found",
+				"error": "user with ID '13' does not exist",
+			},
+		},
+		{
+			name:    "Create Users Success",
+			handler: a.createUsersHandler,
+			requestBody: models.CreateUsersRequest{
+				Users: []models.User{{Name: "John"}, {Name: "Jane"}},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().CreateUsers(gomock.Any(), []models.User{{Name: "John"}, {Name: "Jane"}}).Return([]int64{1, 2}, nil)
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"message":  "Users created successfully",
+				"user_ids": []interface{}{float64(1), float64(2)},
+			},
+		},
+		{
+			name:    "Create Users Error (empty list)",
+			handler: a.createUsersHandler,
+			requestBody: models.CreateUsersRequest{
+				Users: []models.User{},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Users list should not be empty",
+			},
+		},
 		{
 			name:    "Delete User Success",
 			handler: a.deleteUserHandler,
@@ -56,7 +160,7 @@ func TestUserHandlers(t *testing.T) {
 				UserId: 1,
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().DeleteUser(1).Return(1, nil)
+				mockDB.EXPECT().DeleteUser(gomock.Any(), 1).Return(1, nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
@@ -71,10 +175,11 @@ func TestUserHandlers(t *testing.T) {
 				UserId: 12,
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().DeleteUser(12).Return(0, errors.New("user with ID 12 does not exist"))
+				mockDB.EXPECT().DeleteUser(gomock.Any(), 12).Return(0, dbError(db.ErrNotFound, "user with ID 12 does not exist"))
 			},
 			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "user with ID 12 does not exist",
 			},
 		},
@@ -108,7 +213,7 @@ func TestUserHandlers(t *testing.T) {
 				Remove: []string{},
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().UpdateUserSegments(1, gomock.Any(), gomock.Any()).Return(1, nil)
+				mockDB.EXPECT().UpdateUserSegments(gomock.Any(), 1, gomock.Any(), gomock.Any()).Return(1, nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
@@ -146,10 +251,11 @@ func TestUserHandlers(t *testing.T) {
 				Remove: []string{},
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().UpdateUserSegments(13, gomock.Any(), gomock.Any()).Return(0, errors.New("user with ID '13' does not exist"))
+				mockDB.EXPECT().UpdateUserSegments(gomock.Any(), 13, gomock.Any(), gomock.Any()).Return(0, dbError(db.ErrNotFound, "user with ID '13' does not exist"))
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "user with ID '13' does not exist",
 			},
 		},
@@ -183,13 +289,47 @@ func TestUserHandlers(t *testing.T) {
 				Remove: []string{},
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().UpdateUserSegments(1, gomock.Any(), gomock.Any()).Return(0, errors.New("segment with slug 'AVITO_SALE_120' does not exist"))
+				mockDB.EXPECT().UpdateUserSegments(gomock.Any(), 1, gomock.Any(), gomock.Any()).Return(0, dbError(db.ErrNotFound, "segment with slug 'AVITO_SALE_120' does not exist"))
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "segment with slug 'AVITO_SALE_120' does not exist",
 			},
 		},
+		{
+			name:    "Update User Segments Error (exclusion group conflict)",
+			handler: a.updateUserSegmentsHandler,
+			requestBody: models.UpdateSegmentsRequest{
+				UserId: 1,
+				Add:    []models.Segment{{Slug: "EXP_B"}},
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().UpdateUserSegments(gomock.Any(), 1, gomock.Any(), gomock.Any()).Return(0, &db.Error{Kind: db.ErrConflict, Err: fmt.Errorf(
+					"%w: user with ID '1' cannot be added to segment 'EXP_B', already in segment 'EXP_A' of exclusion group 'checkout'",
+					db.ErrExclusionConflict)})
+			},
+			expectedCode: http.StatusConflict,
+			expectedBody: map[string]interface{}{
+				"code":  "conflict",
+				"error": "exclusion group conflict: user with ID '1' cannot be added to segment 'EXP_B', already in segment 'EXP_A' of exclusion group 'checkout'",
+			},
+		},
+		{
+			name:    "Update User Segments Error (segment in both lists)",
+			handler: a.updateUserSegmentsHandler,
+			requestBody: models.UpdateSegmentsRequest{
+				UserId: 1,
+				Add:    []models.Segment{{Slug: "AVITO_SALE_10"}, {Slug: "AVITO_SALE_20"}},
+				Remove: []string{"AVITO_SALE_20"},
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "Segment 'AVITO_SALE_20' cannot be both added and removed",
+			},
+		},
 		{
 			name:    "Get User Segment Success",
 			handler: a.getUserSegmentsHandler,
@@ -197,15 +337,97 @@ func TestUserHandlers(t *testing.T) {
 				UserId: 1,
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().GetUserSegments(1).Return(1, []string{"AVITO_SALE_10", "AVITO_SALE_20"}, nil)
+				mockDB.EXPECT().GetUserHoldouts(gomock.Any(), 1).Return([]string{}, nil)
+				mockDB.EXPECT().GetUserSegments(gomock.Any(), 1, false).Return(1, []models.UserSegment{
+					{
+						Slug:    "AVITO_SALE_10",
+						AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC),
+					},
+					{
+						Slug:    "AVITO_SALE_20",
+						AddedAt: time.Date(2023, 8, 2, 12, 0, 0, 0, time.UTC),
+						ExpirationDate: func() *time.Time {
+							t := time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC)
+							return &t
+						}(),
+					},
+					{
+						Slug:    "CHECKOUT_EXP",
+						AddedAt: time.Date(2023, 8, 3, 12, 0, 0, 0, time.UTC),
+						Variant: "treatment_a",
+					},
+				}, nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
 				"segments": []interface{}{
-					"AVITO_SALE_10",
-					"AVITO_SALE_20",
+					map[string]interface{}{
+						"slug":            "AVITO_SALE_10",
+						"added_at":        "2023-08-01T12:00:00Z",
+						"expiration_date": nil,
+					},
+					map[string]interface{}{
+						"slug":            "AVITO_SALE_20",
+						"added_at":        "2023-08-02T12:00:00Z",
+						"expiration_date": "2023-12-31T23:59:59Z",
+					},
+					map[string]interface{}{
+						"slug":            "CHECKOUT_EXP",
+						"added_at":        "2023-08-03T12:00:00Z",
+						"expiration_date": nil,
+						"variant":         "treatment_a",
+					},
 				},
 				"user_id": float64(1),
+				"holdout": false,
+			},
+		},
+		{
+			name:    "Get User Segment Success (include expired)",
+			handler: a.getUserSegmentsHandler,
+			target:  "/?include_expired=true",
+			requestBody: models.UserSegmentsRequest{
+				UserId: 1,
+			},
+			mockSetup: func() {
+				mockDB.EXPECT().GetUserHoldouts(gomock.Any(), 1).Return([]string{"", "checkout"}, nil)
+				mockDB.EXPECT().GetUserSegments(gomock.Any(), 1, true).Return(1, []models.UserSegment{
+					{
+						Slug:    "AVITO_SALE_10",
+						AddedAt: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC),
+						ExpirationDate: func() *time.Time {
+							t := time.Date(2023, 8, 31, 23, 59, 59, 0, time.UTC)
+							return &t
+						}(),
+					},
+				}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"segments": []interface{}{
+					map[string]interface{}{
+						"slug":            "AVITO_SALE_10",
+						"added_at":        "2023-08-01T12:00:00Z",
+						"expiration_date": "2023-08-31T23:59:59Z",
+					},
+				},
+				"user_id":        float64(1),
+				"holdout":        true,
+				"holdout_groups": []interface{}{"checkout"},
+			},
+		},
+		{
+			name:    "Get User Segment Error (invalid include_expired)",
+			handler: a.getUserSegmentsHandler,
+			target:  "/?include_expired=maybe",
+			requestBody: models.UserSegmentsRequest{
+				UserId: 1,
+			},
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "include_expired should be a boolean",
 			},
 		},
 		{
@@ -215,10 +437,11 @@ func TestUserHandlers(t *testing.T) {
 				UserId: 13,
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().GetUserSegments(13).Return(0, nil, errors.New("user with ID '13' does not exist"))
+				mockDB.EXPECT().GetUserSegments(gomock.Any(), 13, false).Return(0, nil, dbError(db.ErrNotFound, "user with ID '13' does not exist"))
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "user with ID '13' does not exist",
 			},
 		},
@@ -230,7 +453,7 @@ func TestUserHandlers(t *testing.T) {
 				YearMonth: "2023-08",
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().GetUserReport(1, "2023-08").Return("http://localhost:8080/user/report/user_1_report_2023-08.csv", nil)
+				mockDB.EXPECT().GetUserReport(gomock.Any(), 1, august).Return("http://localhost:8080/user/report/user_1_report_2023-08.csv", nil)
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: map[string]interface{}{
@@ -238,6 +461,19 @@ func TestUserHandlers(t *testing.T) {
 				"message":       "Report generated successfully",
 			},
 		},
+		{
+			name:    "Get User Report Error (invalid month)",
+			handler: a.getUserReportHandler,
+			requestBody: models.ReportRequest{
+				UserId:    1,
+				YearMonth: "August",
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "month should be in format YYYY-MM",
+			},
+		},
 		{
 			name:    "Get User Report Error (user does not exist)",
 			handler: a.getUserReportHandler,
@@ -246,10 +482,11 @@ func TestUserHandlers(t *testing.T) {
 				YearMonth: "2023-08",
 			},
 			mockSetup: func() {
-				mockDB.EXPECT().GetUserReport(13, "2023-08").Return("", errors.New("user with ID '13' does not exist"))
+				mockDB.EXPECT().GetUserReport(gomock.Any(), 13, august).Return("", dbError(db.ErrNotFound, "user with ID '13' does not exist"))
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: map[string]interface{}{
+				"code":  "not_found",
 				"error": "user with ID '13' does not exist",
 			},
 		},
@@ -262,8 +499,13 @@ func TestUserHandlers(t *testing.T) {
 				tc.mockSetup()
 			}
 
+			target := tc.target
+			if target == "" {
+				target = "/"
+			}
+
 			requestData, _ := json.Marshal(tc.requestBody)
-			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(requestData))
+			r := httptest.NewRequest("POST", target, bytes.NewBuffer(requestData))
 			w := httptest.NewRecorder()
 
 			ctx, _ := gin.CreateTestContext(w)
@@ -280,3 +522,102 @@ func TestUserHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchUpdateUserSegmentsUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+	a := &App{db: mockDB}
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		file         string
+		segments     string
+		mockSetup    func()
+		expectedCode int
+		expectedBody map[string]interface{}
+	}{
+		{
+			name:     "Upload CSV with header",
+			file:     "user_id,name\n1,Maks\n\n2,Maxim\n",
+			segments: `{"add": [{"slug": "AVITO_SALE_10"}]}`,
+			mockSetup: func() {
+				mockDB.EXPECT().BulkUpdateUserSegments(gomock.Any(), []int{1, 2}, []models.Segment{{Slug: "AVITO_SALE_10"}}, nil).Return(
+					models.BulkUpdateResult{Users: 2, Added: 2, Failures: []models.BulkFailure{}}, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"users":         float64(2),
+				"added":         float64(2),
+				"removed":       float64(0),
+				"failure_count": float64(0),
+				"failures":      []interface{}{},
+			},
+		},
+		{
+			name:         "Upload Error (invalid user ID)",
+			file:         "1\n2\nthree\n",
+			segments:     `{"remove": ["AVITO_SALE_10"]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "line 3: user ID should be an integer, got 'three'",
+			},
+		},
+		{
+			name:         "Upload Error (user ID out of range)",
+			file:         "3000000000\n1\n",
+			segments:     `{"remove": ["AVITO_SALE_10"]}`,
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "line 1: user ID should be between 1 and 2147483647, got '3000000000'",
+			},
+		},
+		{
+			name:         "Upload Error (missing segments)",
+			file:         "1\n",
+			mockSetup:    func() {},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"code":  "invalid_request",
+				"error": "segments should be a JSON object with add and remove lists: unexpected end of JSON input",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := assert.New(t)
+			tc.mockSetup()
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, _ := form.CreateFormFile("file", "users.csv")
+			_, _ = part.Write([]byte(tc.file))
+			_ = form.WriteField("segments", tc.segments)
+			_ = form.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/", &body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = r
+
+			a.batchUpdateUserSegmentsHandler(ctx)
+
+			assertion.Equal(tc.expectedCode, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assertion.NoError(err)
+			assertion.Equal(tc.expectedBody, response)
+		})
+	}
+}
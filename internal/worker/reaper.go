@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"user-segmentation-service/internal/db"
+)
+
+// Reaper периодически удаляет из user_segments записи с истекшим expiration_date
+type Reaper struct {
+	db        db.InterfaceDB
+	interval  time.Duration
+	batchSize int
+}
+
+// NewReaper создаёт новый экземпляр фоновой очистки просроченных сегментов
+func NewReaper(db db.InterfaceDB, interval time.Duration, batchSize int) *Reaper {
+	return &Reaper{db: db, interval: interval, batchSize: batchSize}
+}
+
+// Run запускает очистку и блокируется до отмены контекста
+func (r *Reaper) Run(ctx context.Context) {
+	runEvery(ctx, r.interval, r.reap)
+}
+
+// reap удаляет просроченные записи пачками, пока не будет удалена неполная пачка
+func (r *Reaper) reap(ctx context.Context) {
+	total := 0
+	for ctx.Err() == nil {
+		deleted, err := r.db.DeleteExpiredUserSegments(ctx, r.batchSize)
+		if err != nil {
+			log.Printf("Failed to delete expired user segments: %v\n", err)
+			break
+		}
+
+		total += deleted
+		if deleted < r.batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Expired user segments deleted: %d\n", total)
+	}
+}
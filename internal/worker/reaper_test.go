@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"user-segmentation-service/mocks"
+)
+
+func TestReaperReap(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mockDB *mocks.MockInterface)
+	}{
+		{
+			name: "Reap Until Partial Batch",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().DeleteExpiredUserSegments(gomock.Any(), 10).Return(10, nil),
+					mockDB.EXPECT().DeleteExpiredUserSegments(gomock.Any(), 10).Return(10, nil),
+					mockDB.EXPECT().DeleteExpiredUserSegments(gomock.Any(), 10).Return(3, nil),
+				)
+			},
+		},
+		{
+			name: "Reap Nothing Expired",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().DeleteExpiredUserSegments(gomock.Any(), 10).Return(0, nil)
+			},
+		},
+		{
+			name: "Reap Stops On Error",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().DeleteExpiredUserSegments(gomock.Any(), 10).Return(0, errors.New("connection refused"))
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockInterface(ctrl)
+			tc.mockSetup(mockDB)
+
+			NewReaper(mockDB, time.Minute, 10).reap(context.Background())
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"user-segmentation-service/internal/db"
+	"user-segmentation-service/internal/models"
+)
+
+// ReportWorkers пул обработчиков заданий на создание отчетов
+type ReportWorkers struct {
+	db       db.InterfaceDB
+	workers  int
+	interval time.Duration
+	lease    time.Duration
+}
+
+// NewReportWorkers создаёт новый пул из workers обработчиков, проверяющих очередь заданий с заданным интервалом.
+// Выполняемое задание берется в аренду на срок lease, которая продлевается каждую треть срока.
+func NewReportWorkers(db db.InterfaceDB, workers int, interval, lease time.Duration) *ReportWorkers {
+	return &ReportWorkers{db: db, workers: workers, interval: interval, lease: lease}
+}
+
+// Run запускает обработчики и возврат в очередь заданий с истекшей арендой
+// и блокируется до отмены контекста и завершения всех обработчиков
+func (w *ReportWorkers) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runEvery(ctx, w.interval, w.requeue)
+	}()
+
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runEvery(ctx, w.interval, w.process)
+		}()
+	}
+	wg.Wait()
+}
+
+// requeue возвращает в очередь задания, аренда которых истекла: их обработчик остановлен вместе со своим экземпляром
+// сервиса или потерял связь с базой данных. Задания с действующей арендой, в том числе других экземпляров, не затрагиваются.
+func (w *ReportWorkers) requeue(ctx context.Context) {
+	requeued, err := w.db.RequeueExpiredReportJobs(ctx)
+	if err != nil {
+		log.Printf("Failed to requeue expired report jobs: %v\n", err)
+	} else if requeued > 0 {
+		log.Printf("Expired report jobs requeued: %d\n", requeued)
+	}
+}
+
+// process выполняет задания из очереди, пока она не опустеет
+func (w *ReportWorkers) process(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, ok, err := w.db.ClaimReportJob(ctx, w.lease)
+		if err != nil {
+			log.Printf("Failed to claim report job: %v\n", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		w.run(ctx, job)
+	}
+}
+
+// run выполняет задание, продлевая его аренду каждую треть срока. Если аренда потеряна (истекла, и задание
+// вернули в очередь), создание отчета прерывается: задание уже может выполнять другой обработчик.
+func (w *ReportWorkers) run(ctx context.Context, job models.ReportJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+
+		ticker := time.NewTicker(w.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ok, err := w.db.ExtendReportJobLease(jobCtx, job, w.lease)
+			if err != nil {
+				// Аренда продлевается повторно на следующем шаге, пока не истечет
+				if jobCtx.Err() == nil {
+					log.Printf("Failed to extend lease of report job %d: %v\n", job.ID, err)
+				}
+				continue
+			}
+			if !ok {
+				log.Printf("Lease of report job %d is lost, generation is stopped\n", job.ID)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if err := w.db.RunReportJob(jobCtx, job); err != nil {
+		log.Printf("Failed to generate report for job %d: %v\n", job.ID, err)
+	}
+
+	cancel()
+	<-heartbeat
+}
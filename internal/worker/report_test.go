@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"user-segmentation-service/internal/models"
+	"user-segmentation-service/mocks"
+)
+
+func TestReportWorkersProcess(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mockDB *mocks.MockInterface)
+	}{
+		{
+			name: "Process Until Queue Is Empty",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{ID: 1}, true, nil),
+					mockDB.EXPECT().RunReportJob(gomock.Any(), models.ReportJob{ID: 1}).Return(nil),
+					mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{ID: 2}, true, nil),
+					mockDB.EXPECT().RunReportJob(gomock.Any(), models.ReportJob{ID: 2}).Return(nil),
+					mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{}, false, nil),
+				)
+			},
+		},
+		{
+			name: "Process Continues After Failed Job",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{ID: 1}, true, nil),
+					mockDB.EXPECT().RunReportJob(gomock.Any(), models.ReportJob{ID: 1}).Return(errors.New("disk full")),
+					mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{}, false, nil),
+				)
+			},
+		},
+		{
+			name: "Process Stops On Claim Error",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).Return(models.ReportJob{}, false, errors.New("connection refused"))
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockInterface(ctrl)
+			tc.mockSetup(mockDB)
+
+			NewReportWorkers(mockDB, 1, time.Minute, time.Minute).process(context.Background())
+		})
+	}
+}
+
+func TestReportWorkersRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+
+	// Задания с истекшей арендой возвращаются в очередь в том же цикле, что и проверка очереди
+	ctx, cancel := context.WithCancel(context.Background())
+	requeued := make(chan struct{})
+	mockDB.EXPECT().RequeueExpiredReportJobs(gomock.Any()).DoAndReturn(func(context.Context) (int, error) {
+		close(requeued)
+		return 1, nil
+	})
+	mockDB.EXPECT().ClaimReportJob(gomock.Any(), time.Minute).DoAndReturn(func(context.Context, time.Duration) (models.ReportJob, bool, error) {
+		<-requeued
+		cancel()
+		return models.ReportJob{}, false, nil
+	})
+
+	NewReportWorkers(mockDB, 1, time.Minute, time.Minute).Run(ctx)
+}
+
+func TestReportWorkersLease(t *testing.T) {
+	const lease = 30 * time.Millisecond
+	job := models.ReportJob{ID: 1, Attempts: 2}
+
+	tests := []struct {
+		name      string
+		mockSetup func(mockDB *mocks.MockInterface)
+	}{
+		{
+			name: "Lease Is Extended While Job Runs",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().ExtendReportJobLease(gomock.Any(), job, lease).Return(true, nil).MinTimes(2)
+				mockDB.EXPECT().RunReportJob(gomock.Any(), job).DoAndReturn(func(ctx context.Context, _ models.ReportJob) error {
+					select {
+					case <-ctx.Done():
+						t.Error("job context is canceled while the lease is held")
+					case <-time.After(5 * lease):
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name: "Job Is Stopped When Lease Is Lost",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().ExtendReportJobLease(gomock.Any(), job, lease).Return(false, nil)
+				mockDB.EXPECT().RunReportJob(gomock.Any(), job).DoAndReturn(func(ctx context.Context, _ models.ReportJob) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(time.Second):
+						t.Error("job context is not canceled after the lease is lost")
+						return nil
+					}
+				})
+			},
+		},
+		{
+			name: "Lease Extension Is Retried After Error",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ExtendReportJobLease(gomock.Any(), job, lease).Return(false, errors.New("connection refused")),
+					mockDB.EXPECT().ExtendReportJobLease(gomock.Any(), job, lease).Return(false, nil),
+				)
+				mockDB.EXPECT().RunReportJob(gomock.Any(), job).DoAndReturn(func(ctx context.Context, _ models.ReportJob) error {
+					<-ctx.Done()
+					return ctx.Err()
+				})
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockInterface(ctrl)
+			tc.mockSetup(mockDB)
+
+			NewReportWorkers(mockDB, 1, time.Minute, lease).run(context.Background(), job)
+		})
+	}
+}
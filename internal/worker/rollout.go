@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"user-segmentation-service/internal/db"
+)
+
+// RolloutScheduler периодически применяет наступившие шаги планов постепенной раскатки сегментов
+type RolloutScheduler struct {
+	db       db.InterfaceDB
+	interval time.Duration
+}
+
+// NewRolloutScheduler создаёт новый экземпляр планировщика раскатки
+func NewRolloutScheduler(db db.InterfaceDB, interval time.Duration) *RolloutScheduler {
+	return &RolloutScheduler{db: db, interval: interval}
+}
+
+// Run запускает планировщик и блокируется до отмены контекста
+func (s *RolloutScheduler) Run(ctx context.Context) {
+	runEvery(ctx, s.interval, s.apply)
+}
+
+// apply применяет наступившие шаги всех активных планов раскатки. Планы применяются независимо:
+// ошибка одного плана записывается в лог и не мешает остальным, а план повторяется в следующий раз.
+func (s *RolloutScheduler) apply(ctx context.Context) {
+	rolloutIDs, err := s.db.ListDueRollouts(ctx)
+	if err != nil {
+		log.Printf("Failed to list due rollouts: %v\n", err)
+		return
+	}
+
+	for _, rolloutID := range rolloutIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := s.db.ApplyRolloutSteps(ctx, rolloutID); err != nil {
+			log.Printf("Failed to apply steps of rollout %d: %v\n", rolloutID, err)
+		}
+	}
+}
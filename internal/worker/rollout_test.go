@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"user-segmentation-service/mocks"
+)
+
+func TestRolloutSchedulerApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mockDB *mocks.MockInterface)
+	}{
+		{
+			name: "Apply All Due Rollouts",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return([]int{1, 2}, nil),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 1).Return(true, nil),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 2).Return(true, nil),
+				)
+			},
+		},
+		{
+			name: "Apply Continues After Failed Rollout",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return([]int{1, 2, 3}, nil),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 1).Return(false, errors.New("segment is locked")),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 2).Return(false, context.DeadlineExceeded),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 3).Return(true, nil),
+				)
+			},
+		},
+		{
+			name: "Apply Skips Rollout Taken By Another Instance",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				gomock.InOrder(
+					mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return([]int{1, 2}, nil),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 1).Return(false, nil),
+					mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 2).Return(true, nil),
+				)
+			},
+		},
+		{
+			name: "Apply Nothing Due",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return(nil, nil)
+			},
+		},
+		{
+			name: "Apply Stops On List Error",
+			mockSetup: func(mockDB *mocks.MockInterface) {
+				mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return(nil, errors.New("connection refused"))
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockInterface(ctrl)
+			tc.mockSetup(mockDB)
+
+			NewRolloutScheduler(mockDB, time.Minute).apply(context.Background())
+		})
+	}
+}
+
+func TestRolloutSchedulerStopsOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockInterface(ctrl)
+
+	// Остановка сервиса прерывает обход планов; оставшиеся планы применяются после запуска
+	ctx, cancel := context.WithCancel(context.Background())
+	gomock.InOrder(
+		mockDB.EXPECT().ListDueRollouts(gomock.Any()).Return([]int{1, 2}, nil),
+		mockDB.EXPECT().ApplyRolloutSteps(gomock.Any(), 1).DoAndReturn(func(context.Context, int) (bool, error) {
+			cancel()
+			return false, context.Canceled
+		}),
+	)
+
+	NewRolloutScheduler(mockDB, time.Minute).Run(ctx)
+}
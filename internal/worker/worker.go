@@ -0,0 +1,22 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery вызывает fn сразу и затем с заданным интервалом, пока не будет отменен контекст
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1 @@
+DROP INDEX user_segments_expiration_date_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX user_segments_expiration_date_idx ON user_segments (expiration_date)
+    WHERE expiration_date IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP FUNCTION segment_bucket(TEXT, TEXT, INTEGER);
+
+ALTER TABLE segments DROP COLUMN bucketing;
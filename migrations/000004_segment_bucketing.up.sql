@@ -0,0 +1,6 @@
+ALTER TABLE segments ADD COLUMN bucketing TEXT NOT NULL DEFAULT 'random';
+
+-- Детерминированная корзина пользователя в сегменте в диапазоне [0, 100), см. internal/bucket
+CREATE FUNCTION segment_bucket(salt TEXT, slug TEXT, user_id INTEGER) RETURNS NUMERIC AS $$
+    SELECT (('x' || substr(md5(salt || ':' || slug || ':' || user_id), 1, 8))::bit(32)::bigint % 10000) / 100.0
+$$ LANGUAGE SQL IMMUTABLE;
@@ -0,0 +1,2 @@
+ALTER TABLE segments DROP COLUMN expiration_date;
+ALTER TABLE segments DROP COLUMN random_percentage;
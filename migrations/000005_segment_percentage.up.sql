@@ -0,0 +1,2 @@
+ALTER TABLE segments ADD COLUMN random_percentage NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE segments ADD COLUMN expiration_date TIMESTAMP;
@@ -0,0 +1,3 @@
+DROP TABLE segment_rollout_steps;
+
+DROP TABLE segment_rollouts;
@@ -0,0 +1,25 @@
+CREATE TABLE segment_rollouts
+(
+    id SERIAL PRIMARY KEY,
+    segment_slug VARCHAR(100) NOT NULL REFERENCES segments(slug) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- У сегмента может быть только один незавершенный план раскатки
+CREATE UNIQUE INDEX segment_rollouts_in_progress_idx ON segment_rollouts (segment_slug)
+    WHERE status IN ('active', 'paused');
+
+CREATE TABLE segment_rollout_steps
+(
+    id SERIAL PRIMARY KEY,
+    rollout_id INTEGER NOT NULL REFERENCES segment_rollouts(id) ON DELETE CASCADE,
+    percentage NUMERIC NOT NULL,
+    apply_at TIMESTAMP NOT NULL,
+    applied_at TIMESTAMP,
+    added INTEGER NOT NULL DEFAULT 0,
+    removed INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX segment_rollout_steps_rollout_id_idx ON segment_rollout_steps (rollout_id, apply_at);
@@ -0,0 +1,3 @@
+ALTER TABLE segments DROP COLUMN rule;
+
+ALTER TABLE users DROP COLUMN attributes;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE segments ADD COLUMN rule TEXT;
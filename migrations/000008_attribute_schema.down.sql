@@ -0,0 +1 @@
+DROP TABLE attribute_schema;
@@ -0,0 +1,5 @@
+CREATE TABLE attribute_schema
+(
+    name VARCHAR(100) PRIMARY KEY,
+    type TEXT NOT NULL
+);
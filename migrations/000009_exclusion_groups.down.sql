@@ -0,0 +1,5 @@
+DROP INDEX user_segments_exclusion_group_key;
+
+ALTER TABLE user_segments DROP COLUMN exclusion_group;
+
+ALTER TABLE segments DROP COLUMN exclusion_group;
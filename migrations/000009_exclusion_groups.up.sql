@@ -0,0 +1,8 @@
+ALTER TABLE segments ADD COLUMN exclusion_group VARCHAR(100);
+
+-- Группа сегмента дублируется в user_segments, чтобы уникальный индекс гарантировал
+-- не более одного сегмента группы у пользователя при любом способе добавления
+ALTER TABLE user_segments ADD COLUMN exclusion_group VARCHAR(100);
+
+CREATE UNIQUE INDEX user_segments_exclusion_group_key ON user_segments (user_id, exclusion_group)
+    WHERE exclusion_group IS NOT NULL;
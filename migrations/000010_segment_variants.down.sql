@@ -0,0 +1,6 @@
+DROP FUNCTION segment_variant(TEXT, TEXT, INTEGER);
+
+ALTER TABLE user_segment_history DROP COLUMN variant;
+ALTER TABLE user_segments DROP COLUMN variant;
+
+DROP TABLE segment_variants;
@@ -0,0 +1,25 @@
+CREATE TABLE segment_variants
+(
+    segment_slug VARCHAR(100) NOT NULL REFERENCES segments(slug) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    position INTEGER NOT NULL,
+    PRIMARY KEY (segment_slug, name)
+);
+
+ALTER TABLE user_segments ADD COLUMN variant VARCHAR(100);
+ALTER TABLE user_segment_history ADD COLUMN variant VARCHAR(100);
+
+-- Вариант пользователя в сегменте по накопленным весам вариантов. Корзина варианта считается
+-- от slug || ':variant', чтобы не зависеть от корзины, по которой пользователь попал в сегмент
+CREATE FUNCTION segment_variant(salt TEXT, slug TEXT, user_id INTEGER) RETURNS TEXT AS $$
+    SELECT v.name FROM (
+        SELECT name,
+               SUM(weight) OVER (ORDER BY position) AS upper_bound,
+               SUM(weight) OVER () AS total_weight
+        FROM segment_variants WHERE segment_slug = slug
+    ) v
+    WHERE segment_bucket(salt, slug || ':variant', user_id) * v.total_weight / 100 < v.upper_bound
+    ORDER BY v.upper_bound
+    LIMIT 1
+$$ LANGUAGE SQL STABLE;
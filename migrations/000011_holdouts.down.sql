@@ -0,0 +1,3 @@
+DROP FUNCTION in_holdout(TEXT, TEXT, INTEGER);
+
+DROP TABLE holdouts;
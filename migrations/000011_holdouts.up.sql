@@ -0,0 +1,16 @@
+-- Пустая группа исключения означает глобальный holdout
+CREATE TABLE holdouts
+(
+    exclusion_group VARCHAR(100) PRIMARY KEY,
+    percentage NUMERIC NOT NULL CHECK (percentage > 0 AND percentage <= 100)
+);
+
+-- Пользователь входит в holdout, если его корзина holdout (глобального или группы исключения сегмента)
+-- меньше процента holdout. Корзина не зависит от сегмента, поэтому holdout един для всех сегментов группы
+CREATE FUNCTION in_holdout(salt TEXT, group_name TEXT, user_id INTEGER) RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1 FROM holdouts h
+        WHERE (h.exclusion_group = '' OR h.exclusion_group = group_name)
+          AND segment_bucket(salt, 'holdout:' || h.exclusion_group, user_id) < h.percentage
+    )
+$$ LANGUAGE SQL STABLE;
@@ -0,0 +1,3 @@
+DROP INDEX user_segments_user_id_idx;
+
+DROP INDEX users_name_id_idx;
@@ -0,0 +1,5 @@
+-- Поиск по префиксу имени и постраничный вывод, отсортированный по имени.
+-- Сортировка побайтовая (COLLATE "C"), поэтому индекс подходит и для LIKE 'prefix%'
+CREATE INDEX users_name_id_idx ON users (name COLLATE "C", id);
+
+CREATE INDEX user_segments_user_id_idx ON user_segments (user_id);
@@ -0,0 +1,10 @@
+DROP INDEX user_segment_history_segment_slug_idx;
+
+DROP INDEX user_segments_segment_slug_idx;
+
+DROP INDEX segments_tags_idx;
+
+DROP INDEX segments_slug_idx;
+
+ALTER TABLE segments DROP COLUMN tags;
+ALTER TABLE segments DROP COLUMN created_at;
@@ -0,0 +1,13 @@
+-- Для существующих сегментов время создания неизвестно, им проставляется время миграции
+ALTER TABLE segments ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE segments ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Постраничный вывод по slug и поиск по префиксу slug
+CREATE INDEX segments_slug_idx ON segments (slug COLLATE "C");
+CREATE INDEX segments_tags_idx ON segments USING GIN (tags);
+
+-- Подсчет участников сегмента; первичный ключ (user_id, segment_slug) для этого не подходит
+CREATE INDEX user_segments_segment_slug_idx ON user_segments (segment_slug);
+
+-- Подсчет добавлений и удалений сегмента за период
+CREATE INDEX user_segment_history_segment_slug_idx ON user_segment_history (segment_slug, operation_date);
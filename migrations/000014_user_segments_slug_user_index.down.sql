@@ -0,0 +1,2 @@
+DROP INDEX user_segments_segment_slug_user_id_idx;
+CREATE INDEX user_segments_segment_slug_idx ON user_segments (segment_slug);
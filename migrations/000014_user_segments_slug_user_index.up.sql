@@ -0,0 +1,3 @@
+-- Участники сегмента выбираются постранично в порядке ID пользователя, поэтому индекс по slug дополняется user_id
+DROP INDEX user_segments_segment_slug_idx;
+CREATE INDEX user_segments_segment_slug_user_id_idx ON user_segments (segment_slug, user_id);
@@ -0,0 +1 @@
+DROP INDEX user_segment_history_user_id_idx;
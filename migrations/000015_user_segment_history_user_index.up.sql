@@ -0,0 +1,2 @@
+-- Отчет по истории пользователя за период
+CREATE INDEX user_segment_history_user_id_idx ON user_segment_history (user_id, operation_date);
@@ -0,0 +1,22 @@
+CREATE TABLE report_jobs
+(
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    user_id INTEGER,
+    segment_slug TEXT,
+    period_from TIMESTAMPTZ NOT NULL,
+    period_to TIMESTAMPTZ NOT NULL,
+    time_zone TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    rows_total INTEGER NOT NULL DEFAULT 0,
+    rows_written INTEGER NOT NULL DEFAULT 0,
+    file_name TEXT,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Выбор следующего задания из очереди
+CREATE INDEX report_jobs_queued_idx ON report_jobs (id) WHERE status = 'queued';
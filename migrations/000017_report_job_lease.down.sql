@@ -0,0 +1,2 @@
+DROP INDEX report_jobs_running_idx;
+ALTER TABLE report_jobs DROP COLUMN locked_until;
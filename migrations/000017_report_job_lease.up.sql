@@ -0,0 +1,6 @@
+-- Аренда выполняемого задания: обработчик продлевает ее, пока создает отчет;
+-- задания с истекшей арендой возвращаются в очередь
+ALTER TABLE report_jobs ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Поиск выполняемых заданий с истекшей арендой
+CREATE INDEX report_jobs_running_idx ON report_jobs (locked_until) WHERE status = 'running';
@@ -5,14 +5,17 @@
 package mocks
 
 import (
+	context "context"
+	io "io"
 	reflect "reflect"
 	time "time"
 	models "user-segmentation-service/internal/models"
+	rule "user-segmentation-service/internal/rule"
 
 	gomock "github.com/golang/mock/gomock"
 )
 
-// MockInterface is a mock of Interface interface.
+// MockInterface is a mock of InterfaceDB interface.
 type MockInterface struct {
 	ctrl     *gomock.Controller
 	recorder *MockInterfaceMockRecorder
@@ -35,107 +38,616 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// ApplyRolloutSteps mocks base method.
+func (m *MockInterface) ApplyRolloutSteps(ctx context.Context, rolloutID int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyRolloutSteps", ctx, rolloutID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApplyRolloutSteps indicates an expected call of ApplyRolloutSteps.
+func (mr *MockInterfaceMockRecorder) ApplyRolloutSteps(ctx, rolloutID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyRolloutSteps", reflect.TypeOf((*MockInterface)(nil).ApplyRolloutSteps), ctx, rolloutID)
+}
+
+// BulkUpdateUserSegments mocks base method.
+func (m *MockInterface) BulkUpdateUserSegments(ctx context.Context, userIDs []int, addList []models.Segment, removeList []string) (models.BulkUpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkUpdateUserSegments", ctx, userIDs, addList, removeList)
+	ret0, _ := ret[0].(models.BulkUpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkUpdateUserSegments indicates an expected call of BulkUpdateUserSegments.
+func (mr *MockInterfaceMockRecorder) BulkUpdateUserSegments(ctx, userIDs, addList, removeList interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkUpdateUserSegments", reflect.TypeOf((*MockInterface)(nil).BulkUpdateUserSegments), ctx, userIDs, addList, removeList)
+}
+
+// ClaimReportJob mocks base method.
+func (m *MockInterface) ClaimReportJob(ctx context.Context, lease time.Duration) (models.ReportJob, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimReportJob", ctx, lease)
+	ret0, _ := ret[0].(models.ReportJob)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ClaimReportJob indicates an expected call of ClaimReportJob.
+func (mr *MockInterfaceMockRecorder) ClaimReportJob(ctx, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimReportJob", reflect.TypeOf((*MockInterface)(nil).ClaimReportJob), ctx, lease)
+}
+
+// CreateReportJob mocks base method.
+func (m *MockInterface) CreateReportJob(ctx context.Context, job models.ReportJob) (models.ReportJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReportJob", ctx, job)
+	ret0, _ := ret[0].(models.ReportJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReportJob indicates an expected call of CreateReportJob.
+func (mr *MockInterfaceMockRecorder) CreateReportJob(ctx, job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReportJob", reflect.TypeOf((*MockInterface)(nil).CreateReportJob), ctx, job)
+}
+
+// CreateRollout mocks base method.
+func (m *MockInterface) CreateRollout(ctx context.Context, slug string, steps []models.RolloutStep) (models.Rollout, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRollout", ctx, slug, steps)
+	ret0, _ := ret[0].(models.Rollout)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRollout indicates an expected call of CreateRollout.
+func (mr *MockInterfaceMockRecorder) CreateRollout(ctx, slug, steps interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRollout", reflect.TypeOf((*MockInterface)(nil).CreateRollout), ctx, slug, steps)
+}
+
 // CreateSegment mocks base method.
-func (m *MockInterface) CreateSegment(slug string, randomPercentage float64, expirationDate time.Time) error {
+func (m *MockInterface) CreateSegment(ctx context.Context, segment models.Segment) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateSegment", slug, randomPercentage, expirationDate)
+	ret := m.ctrl.Call(m, "CreateSegment", ctx, segment)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateSegment indicates an expected call of CreateSegment.
-func (mr *MockInterfaceMockRecorder) CreateSegment(slug, randomPercentage, expirationDate interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) CreateSegment(ctx, segment interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockInterface)(nil).CreateSegment), slug, randomPercentage, expirationDate)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockInterface)(nil).CreateSegment), ctx, segment)
 }
 
 // CreateUser mocks base method.
-func (m *MockInterface) CreateUser(name string) (int64, error) {
+func (m *MockInterface) CreateUser(ctx context.Context, user models.User) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", name)
+	ret := m.ctrl.Call(m, "CreateUser", ctx, user)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockInterfaceMockRecorder) CreateUser(name interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) CreateUser(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockInterface)(nil).CreateUser), ctx, user)
+}
+
+// CreateUsers mocks base method.
+func (m *MockInterface) CreateUsers(ctx context.Context, users []models.User) ([]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUsers", ctx, users)
+	ret0, _ := ret[0].([]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUsers indicates an expected call of CreateUsers.
+func (mr *MockInterfaceMockRecorder) CreateUsers(ctx, users interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUsers", reflect.TypeOf((*MockInterface)(nil).CreateUsers), ctx, users)
+}
+
+// DeleteExpiredUserSegments mocks base method.
+func (m *MockInterface) DeleteExpiredUserSegments(ctx context.Context, batchSize int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredUserSegments", ctx, batchSize)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpiredUserSegments indicates an expected call of DeleteExpiredUserSegments.
+func (mr *MockInterfaceMockRecorder) DeleteExpiredUserSegments(ctx, batchSize interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockInterface)(nil).CreateUser), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredUserSegments", reflect.TypeOf((*MockInterface)(nil).DeleteExpiredUserSegments), ctx, batchSize)
 }
 
 // DeleteSegment mocks base method.
-func (m *MockInterface) DeleteSegment(slug string) (int, error) {
+func (m *MockInterface) DeleteSegment(ctx context.Context, slug string) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteSegment", slug)
+	ret := m.ctrl.Call(m, "DeleteSegment", ctx, slug)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeleteSegment indicates an expected call of DeleteSegment.
-func (mr *MockInterfaceMockRecorder) DeleteSegment(slug interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) DeleteSegment(ctx, slug interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegment", reflect.TypeOf((*MockInterface)(nil).DeleteSegment), slug)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegment", reflect.TypeOf((*MockInterface)(nil).DeleteSegment), ctx, slug)
 }
 
 // DeleteUser mocks base method.
-func (m *MockInterface) DeleteUser(userID int) (int, error) {
+func (m *MockInterface) DeleteUser(ctx context.Context, userID int) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUser", userID)
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeleteUser indicates an expected call of DeleteUser.
-func (mr *MockInterfaceMockRecorder) DeleteUser(userID interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockInterface)(nil).DeleteUser), ctx, userID)
+}
+
+// ExtendReportJobLease mocks base method.
+func (m *MockInterface) ExtendReportJobLease(ctx context.Context, job models.ReportJob, lease time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendReportJobLease", ctx, job, lease)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendReportJobLease indicates an expected call of ExtendReportJobLease.
+func (mr *MockInterfaceMockRecorder) ExtendReportJobLease(ctx, job, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendReportJobLease", reflect.TypeOf((*MockInterface)(nil).ExtendReportJobLease), ctx, job, lease)
+}
+
+// GetAttributeSchema mocks base method.
+func (m *MockInterface) GetAttributeSchema(ctx context.Context) (rule.Schema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttributeSchema", ctx)
+	ret0, _ := ret[0].(rule.Schema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttributeSchema indicates an expected call of GetAttributeSchema.
+func (mr *MockInterfaceMockRecorder) GetAttributeSchema(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttributeSchema", reflect.TypeOf((*MockInterface)(nil).GetAttributeSchema), ctx)
+}
+
+// GetHoldouts mocks base method.
+func (m *MockInterface) GetHoldouts(ctx context.Context) ([]models.Holdout, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHoldouts", ctx)
+	ret0, _ := ret[0].([]models.Holdout)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHoldouts indicates an expected call of GetHoldouts.
+func (mr *MockInterfaceMockRecorder) GetHoldouts(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHoldouts", reflect.TypeOf((*MockInterface)(nil).GetHoldouts), ctx)
+}
+
+// GetReportJob mocks base method.
+func (m *MockInterface) GetReportJob(ctx context.Context, jobID int) (models.ReportJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReportJob", ctx, jobID)
+	ret0, _ := ret[0].(models.ReportJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReportJob indicates an expected call of GetReportJob.
+func (mr *MockInterfaceMockRecorder) GetReportJob(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReportJob", reflect.TypeOf((*MockInterface)(nil).GetReportJob), ctx, jobID)
+}
+
+// GetRollout mocks base method.
+func (m *MockInterface) GetRollout(ctx context.Context, slug string) (models.Rollout, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRollout", ctx, slug)
+	ret0, _ := ret[0].(models.Rollout)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRollout indicates an expected call of GetRollout.
+func (mr *MockInterfaceMockRecorder) GetRollout(ctx, slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRollout", reflect.TypeOf((*MockInterface)(nil).GetRollout), ctx, slug)
+}
+
+// GetSegment mocks base method.
+func (m *MockInterface) GetSegment(ctx context.Context, slug string) (models.SegmentDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegment", ctx, slug)
+	ret0, _ := ret[0].(models.SegmentDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegment indicates an expected call of GetSegment.
+func (mr *MockInterfaceMockRecorder) GetSegment(ctx, slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegment", reflect.TypeOf((*MockInterface)(nil).GetSegment), ctx, slug)
+}
+
+// GetSegmentDailyHistory mocks base method.
+func (m *MockInterface) GetSegmentDailyHistory(ctx context.Context, slug string, period models.ReportPeriod) ([]models.SegmentDay, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegmentDailyHistory", ctx, slug, period)
+	ret0, _ := ret[0].([]models.SegmentDay)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegmentDailyHistory indicates an expected call of GetSegmentDailyHistory.
+func (mr *MockInterfaceMockRecorder) GetSegmentDailyHistory(ctx, slug, period interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegmentDailyHistory", reflect.TypeOf((*MockInterface)(nil).GetSegmentDailyHistory), ctx, slug, period)
+}
+
+// GetSegmentReport mocks base method.
+func (m *MockInterface) GetSegmentReport(ctx context.Context, slug string, period models.ReportPeriod) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSegmentReport", ctx, slug, period)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSegmentReport indicates an expected call of GetSegmentReport.
+func (mr *MockInterfaceMockRecorder) GetSegmentReport(ctx, slug, period interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSegmentReport", reflect.TypeOf((*MockInterface)(nil).GetSegmentReport), ctx, slug, period)
+}
+
+// GetUser mocks base method.
+func (m *MockInterface) GetUser(ctx context.Context, userID int) (models.UserDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, userID)
+	ret0, _ := ret[0].(models.UserDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockInterfaceMockRecorder) GetUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockInterface)(nil).GetUser), ctx, userID)
+}
+
+// GetUserAttributes mocks base method.
+func (m *MockInterface) GetUserAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAttributes", ctx, userID)
+	ret0, _ := ret[0].(map[string]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAttributes indicates an expected call of GetUserAttributes.
+func (mr *MockInterfaceMockRecorder) GetUserAttributes(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockInterface)(nil).DeleteUser), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAttributes", reflect.TypeOf((*MockInterface)(nil).GetUserAttributes), ctx, userID)
+}
+
+// GetUserHoldouts mocks base method.
+func (m *MockInterface) GetUserHoldouts(ctx context.Context, userID int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserHoldouts", ctx, userID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserHoldouts indicates an expected call of GetUserHoldouts.
+func (mr *MockInterfaceMockRecorder) GetUserHoldouts(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserHoldouts", reflect.TypeOf((*MockInterface)(nil).GetUserHoldouts), ctx, userID)
 }
 
 // GetUserReport mocks base method.
-func (m *MockInterface) GetUserReport(userID int, yearMonth string) (string, error) {
+func (m *MockInterface) GetUserReport(ctx context.Context, userID int, period models.ReportPeriod) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserReport", userID, yearMonth)
+	ret := m.ctrl.Call(m, "GetUserReport", ctx, userID, period)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserReport indicates an expected call of GetUserReport.
-func (mr *MockInterfaceMockRecorder) GetUserReport(userID, yearMonth interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) GetUserReport(ctx, userID, period interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserReport", reflect.TypeOf((*MockInterface)(nil).GetUserReport), userID, yearMonth)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserReport", reflect.TypeOf((*MockInterface)(nil).GetUserReport), ctx, userID, period)
 }
 
 // GetUserSegments mocks base method.
-func (m *MockInterface) GetUserSegments(userID int) (int, []string, error) {
+func (m *MockInterface) GetUserSegments(ctx context.Context, userID int, includeExpired bool) (int, []models.UserSegment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserSegments", userID)
+	ret := m.ctrl.Call(m, "GetUserSegments", ctx, userID, includeExpired)
 	ret0, _ := ret[0].(int)
-	ret1, _ := ret[1].([]string)
+	ret1, _ := ret[1].([]models.UserSegment)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
 // GetUserSegments indicates an expected call of GetUserSegments.
-func (mr *MockInterfaceMockRecorder) GetUserSegments(userID interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) GetUserSegments(ctx, userID, includeExpired interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSegments", reflect.TypeOf((*MockInterface)(nil).GetUserSegments), ctx, userID, includeExpired)
+}
+
+// GetUsersSegments mocks base method.
+func (m *MockInterface) GetUsersSegments(ctx context.Context, userIDs []int, includeExpired bool) (map[int][]models.UserSegment, []int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsersSegments", ctx, userIDs, includeExpired)
+	ret0, _ := ret[0].(map[int][]models.UserSegment)
+	ret1, _ := ret[1].([]int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetUsersSegments indicates an expected call of GetUsersSegments.
+func (mr *MockInterfaceMockRecorder) GetUsersSegments(ctx, userIDs, includeExpired interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersSegments", reflect.TypeOf((*MockInterface)(nil).GetUsersSegments), ctx, userIDs, includeExpired)
+}
+
+// ImportSegmentUsers mocks base method.
+func (m *MockInterface) ImportSegmentUsers(ctx context.Context, slug string, replace bool, r io.Reader) (models.ImportResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportSegmentUsers", ctx, slug, replace, r)
+	ret0, _ := ret[0].(models.ImportResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportSegmentUsers indicates an expected call of ImportSegmentUsers.
+func (mr *MockInterfaceMockRecorder) ImportSegmentUsers(ctx, slug, replace, r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportSegmentUsers", reflect.TypeOf((*MockInterface)(nil).ImportSegmentUsers), ctx, slug, replace, r)
+}
+
+// ListDueRollouts mocks base method.
+func (m *MockInterface) ListDueRollouts(ctx context.Context) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDueRollouts", ctx)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDueRollouts indicates an expected call of ListDueRollouts.
+func (mr *MockInterfaceMockRecorder) ListDueRollouts(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDueRollouts", reflect.TypeOf((*MockInterface)(nil).ListDueRollouts), ctx)
+}
+
+// ListSegmentHistory mocks base method.
+func (m *MockInterface) ListSegmentHistory(ctx context.Context, query models.SegmentHistoryQuery) (models.SegmentHistoryPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSegmentHistory", ctx, query)
+	ret0, _ := ret[0].(models.SegmentHistoryPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSegmentHistory indicates an expected call of ListSegmentHistory.
+func (mr *MockInterfaceMockRecorder) ListSegmentHistory(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSegmentHistory", reflect.TypeOf((*MockInterface)(nil).ListSegmentHistory), ctx, query)
+}
+
+// ListSegmentMembers mocks base method.
+func (m *MockInterface) ListSegmentMembers(ctx context.Context, query models.SegmentMembersQuery) (models.SegmentMembersPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSegmentMembers", ctx, query)
+	ret0, _ := ret[0].(models.SegmentMembersPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSegmentMembers indicates an expected call of ListSegmentMembers.
+func (mr *MockInterfaceMockRecorder) ListSegmentMembers(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSegmentMembers", reflect.TypeOf((*MockInterface)(nil).ListSegmentMembers), ctx, query)
+}
+
+// ListSegments mocks base method.
+func (m *MockInterface) ListSegments(ctx context.Context, query models.SegmentsQuery) (models.SegmentsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSegments", ctx, query)
+	ret0, _ := ret[0].(models.SegmentsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSegments indicates an expected call of ListSegments.
+func (mr *MockInterfaceMockRecorder) ListSegments(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSegments", reflect.TypeOf((*MockInterface)(nil).ListSegments), ctx, query)
+}
+
+// ListUsers mocks base method.
+func (m *MockInterface) ListUsers(ctx context.Context, query models.UsersQuery) (models.UsersPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, query)
+	ret0, _ := ret[0].(models.UsersPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockInterfaceMockRecorder) ListUsers(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockInterface)(nil).ListUsers), ctx, query)
+}
+
+// RequeueExpiredReportJobs mocks base method.
+func (m *MockInterface) RequeueExpiredReportJobs(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueExpiredReportJobs", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueExpiredReportJobs indicates an expected call of RequeueExpiredReportJobs.
+func (mr *MockInterfaceMockRecorder) RequeueExpiredReportJobs(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueExpiredReportJobs", reflect.TypeOf((*MockInterface)(nil).RequeueExpiredReportJobs), ctx)
+}
+
+// RunReportJob mocks base method.
+func (m *MockInterface) RunReportJob(ctx context.Context, job models.ReportJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunReportJob", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunReportJob indicates an expected call of RunReportJob.
+func (mr *MockInterfaceMockRecorder) RunReportJob(ctx, job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunReportJob", reflect.TypeOf((*MockInterface)(nil).RunReportJob), ctx, job)
+}
+
+// SampleUserAttributes mocks base method.
+func (m *MockInterface) SampleUserAttributes(ctx context.Context, limit int) ([]models.UserAttributes, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SampleUserAttributes", ctx, limit)
+	ret0, _ := ret[0].([]models.UserAttributes)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SampleUserAttributes indicates an expected call of SampleUserAttributes.
+func (mr *MockInterfaceMockRecorder) SampleUserAttributes(ctx, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SampleUserAttributes", reflect.TypeOf((*MockInterface)(nil).SampleUserAttributes), ctx, limit)
+}
+
+// SetAttributeType mocks base method.
+func (m *MockInterface) SetAttributeType(ctx context.Context, name string, attributeType rule.Type) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAttributeType", ctx, name, attributeType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAttributeType indicates an expected call of SetAttributeType.
+func (mr *MockInterfaceMockRecorder) SetAttributeType(ctx, name, attributeType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAttributeType", reflect.TypeOf((*MockInterface)(nil).SetAttributeType), ctx, name, attributeType)
+}
+
+// SetHoldout mocks base method.
+func (m *MockInterface) SetHoldout(ctx context.Context, exclusionGroup string, percentage float64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHoldout", ctx, exclusionGroup, percentage)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetHoldout indicates an expected call of SetHoldout.
+func (mr *MockInterfaceMockRecorder) SetHoldout(ctx, exclusionGroup, percentage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHoldout", reflect.TypeOf((*MockInterface)(nil).SetHoldout), ctx, exclusionGroup, percentage)
+}
+
+// SetRolloutStatus mocks base method.
+func (m *MockInterface) SetRolloutStatus(ctx context.Context, slug, status string) (models.Rollout, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRolloutStatus", ctx, slug, status)
+	ret0, _ := ret[0].(models.Rollout)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetRolloutStatus indicates an expected call of SetRolloutStatus.
+func (mr *MockInterfaceMockRecorder) SetRolloutStatus(ctx, slug, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRolloutStatus", reflect.TypeOf((*MockInterface)(nil).SetRolloutStatus), ctx, slug, status)
+}
+
+// StreamSegmentMembers mocks base method.
+func (m *MockInterface) StreamSegmentMembers(ctx context.Context, slug string, fn func(models.SegmentMember) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamSegmentMembers", ctx, slug, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamSegmentMembers indicates an expected call of StreamSegmentMembers.
+func (mr *MockInterfaceMockRecorder) StreamSegmentMembers(ctx, slug, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamSegmentMembers", reflect.TypeOf((*MockInterface)(nil).StreamSegmentMembers), ctx, slug, fn)
+}
+
+// UpdateSegment mocks base method.
+func (m *MockInterface) UpdateSegment(ctx context.Context, slug string, update models.UpdateSegmentRequest) (models.MembershipChanges, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSegment", ctx, slug, update)
+	ret0, _ := ret[0].(models.MembershipChanges)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSegment indicates an expected call of UpdateSegment.
+func (mr *MockInterfaceMockRecorder) UpdateSegment(ctx, slug, update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSegment", reflect.TypeOf((*MockInterface)(nil).UpdateSegment), ctx, slug, update)
+}
+
+// UpdateUserAttributes mocks base method.
+func (m *MockInterface) UpdateUserAttributes(ctx context.Context, userID int, attributes map[string]interface{}) (models.MembershipChanges, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserAttributes", ctx, userID, attributes)
+	ret0, _ := ret[0].(models.MembershipChanges)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserAttributes indicates an expected call of UpdateUserAttributes.
+func (mr *MockInterfaceMockRecorder) UpdateUserAttributes(ctx, userID, attributes interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSegments", reflect.TypeOf((*MockInterface)(nil).GetUserSegments), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserAttributes", reflect.TypeOf((*MockInterface)(nil).UpdateUserAttributes), ctx, userID, attributes)
 }
 
 // UpdateUserSegments mocks base method.
-func (m *MockInterface) UpdateUserSegments(userID int, addList []models.Segment, removeList []string) (int, error) {
+func (m *MockInterface) UpdateUserSegments(ctx context.Context, userID int, addList []models.Segment, removeList []string) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUserSegments", userID, addList, removeList)
+	ret := m.ctrl.Call(m, "UpdateUserSegments", ctx, userID, addList, removeList)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateUserSegments indicates an expected call of UpdateUserSegments.
-func (mr *MockInterfaceMockRecorder) UpdateUserSegments(userID, addList, removeList interface{}) *gomock.Call {
+func (mr *MockInterfaceMockRecorder) UpdateUserSegments(ctx, userID, addList, removeList interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserSegments", reflect.TypeOf((*MockInterface)(nil).UpdateUserSegments), userID, addList, removeList)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserSegments", reflect.TypeOf((*MockInterface)(nil).UpdateUserSegments), ctx, userID, addList, removeList)
 }